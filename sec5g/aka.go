@@ -0,0 +1,106 @@
+package sec5g
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// 5G Home Environment Authentication Vector (TS 33.501 6.1.3.2)
+type HeAv struct {
+	Rand     []uint8
+	Autn     []uint8 //SQN xor AK || AMF || MAC-A
+	XresStar []uint8
+	Kausf    []uint8
+}
+
+// 5G Serving Environment Authentication Vector sent from AUSF to SEAF
+type SeAv struct {
+	Rand      []uint8
+	Autn      []uint8
+	HxresStar []uint8
+	Kseaf     []uint8
+}
+
+// GenerateHeAv builds a 5G HE AV with a new random vector from the given
+// authentication function set. The AMF separation bit must be set.
+func GenerateHeAv(f AuthFunctions, sqn, amf []uint8, servingnet []byte) (av *HeAv, err error) {
+	if err = checkHeAvInput(sqn, amf); err != nil {
+		return
+	}
+	f.Refresh()
+	var maca []uint8
+	if maca, _, err = f.F1(sqn, amf); err != nil {
+		return
+	}
+	res, ak := f.F2F5()
+	av, err = buildHeAv(f.GetRand(), sqn, amf, maca, res, ak, append(f.F3(), f.F4()...), servingnet)
+	return
+}
+
+func checkHeAvInput(sqn, amf []uint8) error {
+	if len(sqn) != 6 || len(amf) != 2 {
+		return fmt.Errorf("Wrong size input")
+	}
+	if amf[0]&0x80 == 0 {
+		return fmt.Errorf("AMF separation bit is not set")
+	}
+	return nil
+}
+
+// AUTN = SQN xor AK || AMF || MAC-A
+func buildAutn(sqn, amf, maca, ak []uint8) []uint8 {
+	autn := make([]uint8, 0, 16)
+	for i := 0; i < 6; i++ {
+		autn = append(autn, sqn[i]^ak[i])
+	}
+	return append(append(autn, amf...), maca...)
+}
+
+// assemble AUTN and derive XRES* and KAUSF from the function outputs
+func buildHeAv(randv, sqn, amf, maca, res, ak, ckik []uint8, servingnet []byte) (av *HeAv, err error) {
+	av = &HeAv{
+		Rand: append([]uint8{}, randv...),
+		Autn: buildAutn(sqn, amf, maca, ak),
+	}
+
+	if _, av.XresStar, err = ResstarXresstar(ckik, servingnet, av.Rand, res); err != nil {
+		return nil, err
+	}
+	if av.Kausf, err = KAUSF(ckik, servingnet, av.Autn[:6]); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// GenerateMilenageHeAv builds a 5G HE AV for a Milenage subscriber
+func GenerateMilenageHeAv(k, opc, sqn, amf []uint8, servingnet []byte) (av *HeAv, err error) {
+	var m *Milenage
+	if m, err = NewMilenage(k, opc, true); err != nil {
+		return
+	}
+	av, err = GenerateHeAv(m, sqn, amf, servingnet)
+	return
+}
+
+// SeAv derives the AUSF-side vector: HXRES* and KSEAF
+func (av *HeAv) SeAv(servingnet []byte) (se *SeAv, err error) {
+	se = &SeAv{
+		Rand:      av.Rand,
+		Autn:      av.Autn,
+		HxresStar: HxresStar(av.Rand, av.XresStar),
+	}
+	if se.Kseaf, err = SeafKey(av.Kausf, servingnet); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// HxresStar computes HXRES* (or HRES*) as the 128 least significant bits of
+// SHA-256(RAND || XRES*) (TS 33.501 A.5)
+func HxresStar(rand, xresstar []byte) []byte {
+	h := sha256.New()
+	h.Write(rand)
+	h.Write(xresstar)
+	sum := h.Sum(nil)
+	return sum[16:]
+}
@@ -0,0 +1,65 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestGenerateHeAv(t *testing.T) {
+	//TS 35.208 test set 1
+	K, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	OP, _ := hex.DecodeString("cdc202d5123e20f62b6d676ac72cb318")
+	RAND, _ := hex.DecodeString("23553cbe9637a89d218ae64dae47bf35")
+	SQN, _ := hex.DecodeString("ff9bb4d0b607")
+	AMF, _ := hex.DecodeString("b9b9")
+	eAUTN, _ := hex.DecodeString("55f328b43577b9b94a9ffac354dfafb3")
+	eRES, _ := hex.DecodeString("a54211d5e3ba50bf")
+	eCKIK, _ := hex.DecodeString("b40ba9a3c58b2a05bbf0d987b21bf8cbf769bcd751044604127672711c6d3441")
+	snn := []byte("5G:mnc093.mcc208.3gppnetwork.org")
+
+	m, _ := NewMilenageEx(K, bytes.NewReader(bytes.Repeat(RAND, 2)), OP, false)
+	av, err := GenerateHeAv(m, SQN, AMF, snn)
+	if err != nil {
+		t.Fatalf("GenerateHeAv failed: %+v", err)
+	}
+	if !bytes.Equal(av.Rand, RAND) {
+		t.Errorf("wrong RAND %x", av.Rand)
+	}
+	if !bytes.Equal(av.Autn, eAUTN) {
+		t.Errorf("wrong AUTN %x", av.Autn)
+	}
+	_, xresstar, _ := ResstarXresstar(eCKIK, snn, RAND, eRES)
+	if !bytes.Equal(av.XresStar, xresstar) {
+		t.Errorf("wrong XRES* %x", av.XresStar)
+	}
+	kausf, _ := KAUSF(eCKIK, snn, eAUTN[:6])
+	if !bytes.Equal(av.Kausf, kausf) {
+		t.Errorf("wrong KAUSF %x", av.Kausf)
+	}
+
+	se, err := av.SeAv(snn)
+	if err != nil {
+		t.Fatalf("SeAv failed: %+v", err)
+	}
+	kseaf, _ := SeafKey(kausf, snn)
+	if !bytes.Equal(se.Kseaf, kseaf) {
+		t.Errorf("wrong KSEAF %x", se.Kseaf)
+	}
+	if !bytes.Equal(se.HxresStar, HxresStar(RAND, xresstar)) {
+		t.Errorf("wrong HXRES* %x", se.HxresStar)
+	}
+
+	if _, err = GenerateHeAv(m, SQN, []uint8{0x00, 0x00}, snn); err == nil {
+		t.Errorf("AMF without separation bit must be rejected")
+	}
+}
+
+func TestHxresStar(t *testing.T) {
+	RAND, _ := hex.DecodeString("23553cbe9637a89d218ae64dae47bf35")
+	XRESSTAR, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	eHXRESSTAR := "2e04e14c41322599308afeb46cc18b9c"
+	if h := hex.EncodeToString(HxresStar(RAND, XRESSTAR)); h != eHXRESSTAR {
+		t.Errorf("wrong HXRES* %s", h)
+	}
+}
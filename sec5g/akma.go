@@ -0,0 +1,74 @@
+package sec5g
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// AKMA key derivations and A-KID (TS 33.535 6.1 and Annex A)
+
+const (
+	akmaLabel = "AKMA"
+	atidLabel = "A-TID"
+)
+
+// KAKMA derives the AKMA anchor key from KAUSF and the SUPI. The SUPI is
+// encoded as in TS 33.501 A.7.0: the IMSI digits (e.g. "208930000000001",
+// without the "imsi-" prefix) for an IMSI based SUPI, the NAI otherwise
+func KAKMA(kausf, supi []byte) (kakma []byte, err error) {
+	kakma, err = KDF(kausf, FC_FOR_KAKMA_DERIVATION, []byte(akmaLabel), supi)
+	return
+}
+
+// ATID derives the AKMA temporary identifier from KAUSF and the SUPI, encoded
+// as for KAKMA
+func ATID(kausf, supi []byte) (atid []byte, err error) {
+	atid, err = KDF(kausf, FC_FOR_A_TID_DERIVATION, []byte(atidLabel), supi)
+	return
+}
+
+// KAF derives the application function key from KAKMA and AF_ID (FQDN of the
+// AF followed by the Ua* security protocol identifier)
+func KAF(kakma, afid []byte) (kaf []byte, err error) {
+	kaf, err = KDF(kakma, FC_FOR_KAF_DERIVATION, afid)
+	return
+}
+
+// AKID builds the A-KID NAI: the username is the routing indicator and the
+// hex encoded A-TID separated by a dot, the realm is the home network domain
+// (e.g. 5gc.mnc093.mcc208.3gppnetwork.org)
+func AKID(routing string, atid []byte, realm string) (akid string, err error) {
+	if l := len(routing); l < 1 || l > 4 || !isDigits(routing) {
+		err = fmt.Errorf("Invalid routing indicator %s", routing)
+		return
+	}
+	if len(atid) == 0 || len(realm) == 0 || strings.Contains(realm, "@") {
+		err = fmt.Errorf("Invalid A-TID or realm")
+		return
+	}
+	akid = fmt.Sprintf("%s.%x@%s", routing, atid, realm)
+	return
+}
+
+// ParseAKID splits an A-KID built by AKID
+func ParseAKID(akid string) (routing string, atid []byte, realm string, err error) {
+	username, realm, found := strings.Cut(akid, "@")
+	if !found || len(realm) == 0 || strings.Contains(realm, "@") {
+		err = fmt.Errorf("Invalid A-KID %s", akid)
+		return
+	}
+	var tid string
+	if routing, tid, found = strings.Cut(username, "."); !found {
+		err = fmt.Errorf("Invalid A-KID %s", akid)
+		return
+	}
+	if l := len(routing); l < 1 || l > 4 || !isDigits(routing) {
+		err = fmt.Errorf("Invalid routing indicator %s", routing)
+		return
+	}
+	if atid, err = hex.DecodeString(tid); err != nil || len(atid) == 0 {
+		err = fmt.Errorf("Invalid A-TID %s", tid)
+	}
+	return
+}
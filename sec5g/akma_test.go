@@ -0,0 +1,56 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAkmaKeys(t *testing.T) {
+	kausf, _ := hex.DecodeString("9d0b6fc0d52a8cbc8ad7d4fb0d8ec56d8f3da4c6e2f1bd9b77c0a4d5e6f70819")
+	//IMSI digits, as TS 33.501 A.7.0 and TS 33.535 A.2/A.3 use them
+	supi := []byte("208930000000001")
+
+	//TS 33.535 has no test data for these keys
+	//80 || "AKMA" || 0004 || SUPI || 000f
+	kakma, err := KAKMA(kausf, supi)
+	if err != nil {
+		t.Fatalf("KAKMA failed: %+v", err)
+	}
+	if hex.EncodeToString(kakma) != "95ea85927d20299673c9b90940ce952fbc24b88927059a9cbc24397e7191623f" {
+		t.Errorf("wrong KAKMA %x", kakma)
+	}
+	//81 || "A-TID" || 0005 || SUPI || 000f
+	atid, _ := ATID(kausf, supi)
+	if hex.EncodeToString(atid) != "2d95aeee164ddaf89c8424c35c1eb03cc2f085eba7e921e53b5e85c2159e5c38" {
+		t.Errorf("wrong A-TID %x", atid)
+	}
+	//82 || AF_ID || 000e
+	afid := []byte("af.example.com")
+	kaf, _ := KAF(kakma, afid)
+	if hex.EncodeToString(kaf) != "78acac3ec4a88f342a6071058d96f832a778ff6482ee633c0a9240f9fed10dce" {
+		t.Errorf("wrong KAF %x", kaf)
+	}
+
+	realm := "5gc.mnc093.mcc208.3gppnetwork.org"
+	akid, err := AKID("0012", atid, realm)
+	if err != nil {
+		t.Fatalf("AKID failed: %+v", err)
+	}
+	if akid != "0012."+hex.EncodeToString(atid)+"@"+realm {
+		t.Errorf("wrong A-KID %s", akid)
+	}
+	rid, tid, r, err := ParseAKID(akid)
+	if err != nil || rid != "0012" || !bytes.Equal(tid, atid) || r != realm {
+		t.Errorf("ParseAKID failed: %s %x %s %+v", rid, tid, r, err)
+	}
+
+	if _, err = AKID("12345", atid, realm); err == nil {
+		t.Errorf("long routing indicator must be rejected")
+	}
+	for _, bad := range []string{"0012.abcd", "0012@" + realm, "x.abcd@" + realm, "1.zz@" + realm, "1.ab@"} {
+		if _, _, _, err = ParseAKID(bad); err == nil {
+			t.Errorf("%s must be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package sec5g
+
+import "fmt"
+
+// ciphering algorithm identities (TS 33.501 5.11.1.1)
+type CipheringAlgorithm uint8
+
+const (
+	ALG_NEA0 CipheringAlgorithm = 0 //null ciphering
+	ALG_NEA1 CipheringAlgorithm = 1 //SNOW 3G
+	ALG_NEA2 CipheringAlgorithm = 2 //AES
+	ALG_NEA3 CipheringAlgorithm = 3 //ZUC
+)
+
+// integrity algorithm identities (TS 33.501 5.11.1.2)
+type IntegrityAlgorithm uint8
+
+const (
+	ALG_NIA0 IntegrityAlgorithm = 0 //null integrity
+	ALG_NIA1 IntegrityAlgorithm = 1 //SNOW 3G
+	ALG_NIA2 IntegrityAlgorithm = 2 //AES
+	ALG_NIA3 IntegrityAlgorithm = 3 //ZUC
+)
+
+func (a CipheringAlgorithm) String() string {
+	return fmt.Sprintf("NEA%d", uint8(a))
+}
+
+func (a IntegrityAlgorithm) String() string {
+	return fmt.Sprintf("NIA%d", uint8(a))
+}
+
+// Cipher runs the algorithm on the first length bits of data; NEA0 returns
+// them unchanged
+func (a CipheringAlgorithm) Cipher(key []byte, count uint32, bearer, direction uint8, data []byte, length uint32) ([]byte, error) {
+	switch a {
+	case ALG_NEA0:
+		n := int((length + 7) / 8)
+		if len(data) < n {
+			return nil, fmt.Errorf("Data is shorter than %d bits", length)
+		}
+		return append([]byte{}, data[:n]...), nil
+	case ALG_NEA1:
+		return NEA1(key, count, bearer, direction, data, length)
+	case ALG_NEA2:
+		return NEA2(key, count, bearer, direction, data, length)
+	case ALG_NEA3:
+		return NEA3(key, count, bearer, direction, data, length)
+	}
+	return nil, fmt.Errorf("Unsupported ciphering algorithm %s", a)
+}
+
+// Mac computes the 32 bit MAC over the first length bits of data; NIA0
+// returns zeros
+func (a IntegrityAlgorithm) Mac(key []byte, count uint32, bearer, direction uint8, data []byte, length uint32) ([]byte, error) {
+	switch a {
+	case ALG_NIA0:
+		return make([]byte, 4), nil
+	case ALG_NIA1:
+		return NIA1(key, count, bearer, direction, data, length)
+	case ALG_NIA2:
+		return NIA2(key, count, bearer, direction, data, length)
+	case ALG_NIA3:
+		return NIA3(key, count, bearer, direction, data, length)
+	}
+	return nil, fmt.Errorf("Unsupported integrity algorithm %s", a)
+}
+
+// algorithm type distinguishers of the algorithm key derivation (TS 33.501
+// A.8)
+type AlgorithmTypeDistinguisher uint8
+
+const (
+	ALG_TYPE_NAS_ENC AlgorithmTypeDistinguisher = 0x01 //N-NAS-enc-alg
+	ALG_TYPE_NAS_INT AlgorithmTypeDistinguisher = 0x02 //N-NAS-int-alg
+	ALG_TYPE_RRC_ENC AlgorithmTypeDistinguisher = 0x03 //N-RRC-enc-alg
+	ALG_TYPE_RRC_INT AlgorithmTypeDistinguisher = 0x04 //N-RRC-int-alg
+	ALG_TYPE_UP_ENC  AlgorithmTypeDistinguisher = 0x05 //N-UP-enc-alg
+	ALG_TYPE_UP_INT  AlgorithmTypeDistinguisher = 0x06 //N-UP-int-alg
+)
+
+// AlgorithmKey derives a 128 bit algorithm key from KAMF (NAS) or KgNB (RRC
+// and UP): the 128 least significant bits of the KDF output
+func AlgorithmKey(key []byte, distinguisher AlgorithmTypeDistinguisher, algid uint8) (k []byte, err error) {
+	if distinguisher < ALG_TYPE_NAS_ENC || distinguisher > ALG_TYPE_UP_INT {
+		err = fmt.Errorf("Unknown algorithm type distinguisher %d", distinguisher)
+		return
+	}
+	if algid > 0x0f {
+		err = fmt.Errorf("Invalid algorithm identity %d", algid)
+		return
+	}
+	if k, err = AlgKey(key, []byte{uint8(distinguisher)}, []byte{algid}); err != nil {
+		return
+	}
+	k = k[16:]
+	return
+}
+
+func KNasEnc(kamf []byte, alg CipheringAlgorithm) ([]byte, error) {
+	return AlgorithmKey(kamf, ALG_TYPE_NAS_ENC, uint8(alg))
+}
+
+func KNasInt(kamf []byte, alg IntegrityAlgorithm) ([]byte, error) {
+	return AlgorithmKey(kamf, ALG_TYPE_NAS_INT, uint8(alg))
+}
+
+func KRrcEnc(kgnb []byte, alg CipheringAlgorithm) ([]byte, error) {
+	return AlgorithmKey(kgnb, ALG_TYPE_RRC_ENC, uint8(alg))
+}
+
+func KRrcInt(kgnb []byte, alg IntegrityAlgorithm) ([]byte, error) {
+	return AlgorithmKey(kgnb, ALG_TYPE_RRC_INT, uint8(alg))
+}
+
+func KUpEnc(kgnb []byte, alg CipheringAlgorithm) ([]byte, error) {
+	return AlgorithmKey(kgnb, ALG_TYPE_UP_ENC, uint8(alg))
+}
+
+func KUpInt(kgnb []byte, alg IntegrityAlgorithm) ([]byte, error) {
+	return AlgorithmKey(kgnb, ALG_TYPE_UP_INT, uint8(alg))
+}
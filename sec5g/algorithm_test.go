@@ -0,0 +1,37 @@
+package sec5g
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestAlgorithmKeys(t *testing.T) {
+	key, _ := hex.DecodeString("2f7c6b6e5d4c3b2a1908f7e6d5c4b3a2918f7e6d5c4b3a29180f1e2d3c4b5a69")
+	cases := []struct {
+		derive func() ([]byte, error)
+		expect string
+	}{
+		//last 16 bytes of KDF over 69 || distinguisher || 0001 || algorithm identity || 0001
+		{func() ([]byte, error) { return KNasEnc(key, ALG_NEA2) }, "55d63d1fac1b07499b604dcaa36dee4e"},
+		{func() ([]byte, error) { return KNasInt(key, ALG_NIA2) }, "43fb43b607245ddd45f2e4fdcc86e055"},
+		{func() ([]byte, error) { return KRrcEnc(key, ALG_NEA1) }, "2a70795ea46b6a575b2b06f0ae9b1490"},
+		{func() ([]byte, error) { return KRrcInt(key, ALG_NIA3) }, "04c9c65a8294b8a4bd7652cd01c3ca20"},
+		{func() ([]byte, error) { return KUpEnc(key, ALG_NEA0) }, "641e80cf16bd0206a496a4f4dac62365"},
+		{func() ([]byte, error) { return KUpInt(key, ALG_NIA1) }, "79310303c55e6fe27d418cc1b0132d32"},
+	}
+	for i, c := range cases {
+		k, err := c.derive()
+		if err != nil {
+			t.Fatalf("case %d failed: %+v", i, err)
+		}
+		if hex.EncodeToString(k) != c.expect {
+			t.Errorf("case %d: wrong key %x", i, k)
+		}
+	}
+	if _, err := AlgorithmKey(key, 7, 1); err == nil {
+		t.Errorf("unknown distinguisher must be rejected")
+	}
+	if _, err := KNasEnc(key, CipheringAlgorithm(16)); err == nil {
+		t.Errorf("invalid algorithm identity must be rejected")
+	}
+}
@@ -0,0 +1,95 @@
+package sec5g
+
+import (
+	"fmt"
+	"sync"
+)
+
+// algorithm identifiers of the built-in authentication function sets
+const (
+	AUTH_ALG_MILENAGE = "milenage"
+	AUTH_ALG_TUAK     = "tuak"
+)
+
+// AuthFunctions is an authentication and key generation function set
+// (f1, f1*, f2-f5, f5*) bound to a subscriber key. Milenage and Tuak
+// implement it.
+type AuthFunctions interface {
+	Refresh()                                                    //prepare a new random vector
+	SetRand(r []uint8) error                                     //set a new random vector
+	GetRand() []uint8                                            //current random vector
+	F1(sqn, amf []uint8) (maca []uint8, macs []uint8, err error) //f1 and f1*
+	F2F5() (res []uint8, ak []uint8)                             //f2 and f5
+	F3() []uint8                                                 //ck
+	F4() []uint8                                                 //ik
+	F5star() []uint8                                             //ak*
+	ValidateAuts(auts, randv []byte) (sqn [6]uint8, err error)   //resync
+}
+
+// AuthFunctionsCreator builds an AuthFunctions from a subscriber's long-term
+// key and operator variant configuration (OP/OPc, TOP/TOPc, ...); isopc
+// tells whether the operator value has already been derived with the key
+type AuthFunctionsCreator func(k []uint8, op []uint8, isopc bool) (AuthFunctions, error)
+
+var authRegistry = struct {
+	creators map[string]AuthFunctionsCreator
+	mutex    sync.RWMutex
+}{
+	creators: map[string]AuthFunctionsCreator{
+		AUTH_ALG_MILENAGE: func(k []uint8, op []uint8, isopc bool) (AuthFunctions, error) {
+			m, err := NewMilenage(k, op, isopc)
+			if err != nil {
+				return nil, err //no typed nil in the interface
+			}
+			return m, nil
+		},
+		AUTH_ALG_TUAK: func(k []uint8, op []uint8, isopc bool) (AuthFunctions, error) {
+			t, err := NewTuak(k, op, isopc)
+			if err != nil {
+				return nil, err
+			}
+			return t, nil
+		},
+	},
+}
+
+// RegisterAuthFunctions adds (or replaces) the function set for an
+// algorithm identifier
+func RegisterAuthFunctions(alg string, creator AuthFunctionsCreator) error {
+	if len(alg) == 0 || creator == nil {
+		return fmt.Errorf("Invalid authentication function set")
+	}
+	authRegistry.mutex.Lock()
+	defer authRegistry.mutex.Unlock()
+	authRegistry.creators[alg] = creator
+	return nil
+}
+
+// UnregisterAuthFunctions removes the function set of an algorithm identifier
+func UnregisterAuthFunctions(alg string) {
+	authRegistry.mutex.Lock()
+	defer authRegistry.mutex.Unlock()
+	delete(authRegistry.creators, alg)
+}
+
+// NewAuthFunctions creates the function set registered for an algorithm
+// identifier (e.g. from a subscriber profile)
+func NewAuthFunctions(alg string, k []uint8, op []uint8, isopc bool) (AuthFunctions, error) {
+	authRegistry.mutex.RLock()
+	creator, ok := authRegistry.creators[alg]
+	authRegistry.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown authentication algorithm %s", alg)
+	}
+	return creator(k, op, isopc)
+}
+
+// AuthAlgorithms lists the registered algorithm identifiers
+func AuthAlgorithms() (algs []string) {
+	authRegistry.mutex.RLock()
+	defer authRegistry.mutex.RUnlock()
+	for alg := range authRegistry.creators {
+		algs = append(algs, alg)
+	}
+	return
+}
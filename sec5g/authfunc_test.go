@@ -0,0 +1,56 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+var _ AuthFunctions = (*Milenage)(nil)
+var _ AuthFunctions = (*Tuak)(nil)
+
+func TestAuthFunctionsRegistry(t *testing.T) {
+	K, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	OP, _ := hex.DecodeString("cdc202d5123e20f62b6d676ac72cb318")
+	RAND, _ := hex.DecodeString("23553cbe9637a89d218ae64dae47bf35")
+	eRES, _ := hex.DecodeString("a54211d5e3ba50bf")
+
+	f, err := NewAuthFunctions(AUTH_ALG_MILENAGE, K, OP, false)
+	if err != nil {
+		t.Fatalf("failed to create Milenage: %+v", err)
+	}
+	f.SetRand(RAND)
+	if res, _ := f.F2F5(); !bytes.Equal(res, eRES) {
+		t.Errorf("wrong RES from registry Milenage")
+	}
+
+	TOP := bytes.Repeat([]uint8{0x55}, 32)
+	if _, err = NewAuthFunctions(AUTH_ALG_TUAK, K, TOP, false); err != nil {
+		t.Errorf("failed to create Tuak: %+v", err)
+	}
+
+	//a failed creation gives a nil interface, not a typed nil
+	for _, alg := range []string{AUTH_ALG_MILENAGE, AUTH_ALG_TUAK} {
+		if f, err := NewAuthFunctions(alg, K[:8], OP, false); err == nil || f != nil {
+			t.Errorf("%s: short key must give a nil function set and an error", alg)
+		}
+	}
+
+	if _, err = NewAuthFunctions("xor", K, OP, false); err == nil {
+		t.Errorf("unknown algorithm must be rejected")
+	}
+
+	//an operator-proprietary set can take over an identifier
+	if err = RegisterAuthFunctions("proprietary", func(k []uint8, op []uint8, isopc bool) (AuthFunctions, error) {
+		return NewMilenage(k, op, isopc)
+	}); err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+	defer UnregisterAuthFunctions("proprietary")
+	if _, err = NewAuthFunctions("proprietary", K, OP, false); err != nil {
+		t.Errorf("failed to create a registered set: %+v", err)
+	}
+	if err = RegisterAuthFunctions("nil", nil); err == nil {
+		t.Errorf("nil creator must be rejected")
+	}
+}
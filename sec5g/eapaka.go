@@ -0,0 +1,257 @@
+package sec5g
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// EAP-AKA' (RFC 9048) key derivation and packet codec
+
+const (
+	EAP_CODE_REQUEST  uint8 = 1
+	EAP_CODE_RESPONSE uint8 = 2
+	EAP_CODE_SUCCESS  uint8 = 3
+	EAP_CODE_FAILURE  uint8 = 4
+
+	EAP_TYPE_AKA_PRIME uint8 = 50
+
+	AKA_SUBTYPE_CHALLENGE               uint8 = 1
+	AKA_SUBTYPE_AUTHENTICATION_REJECT   uint8 = 2
+	AKA_SUBTYPE_SYNCHRONIZATION_FAILURE uint8 = 4
+
+	AT_RAND      uint8 = 1
+	AT_AUTN      uint8 = 2
+	AT_RES       uint8 = 3
+	AT_AUTS      uint8 = 4
+	AT_MAC       uint8 = 11
+	AT_KDF_INPUT uint8 = 23
+	AT_KDF       uint8 = 24
+
+	AKA_PRIME_KDF uint16 = 1 //EAP-AKA' with CK'/IK'
+)
+
+// keys expanded from the EAP-AKA' master key
+type EapAkaPrimeKeys struct {
+	KEncr []uint8 //128 bits
+	KAut  []uint8 //256 bits
+	KRe   []uint8 //256 bits
+	Msk   []uint8 //512 bits
+	Emsk  []uint8 //512 bits
+}
+
+// PRF' of RFC 9048 3.4.1: T1 | T2 | ... truncated to size bytes
+func PrfPrime(key, s []byte, size int) []byte {
+	mac := hmac.New(sha256.New, key)
+	out := make([]byte, 0, size+sha256.Size)
+	var t []byte
+	for i := 1; len(out) < size; i++ {
+		mac.Reset()
+		mac.Write(t)
+		mac.Write(s)
+		mac.Write([]byte{uint8(i)})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:size]
+}
+
+// EapAkaPrimeKeysDerive expands MK = PRF'(IK'|CK', "EAP-AKA'"|Identity)
+func EapAkaPrimeKeysDerive(ckprime, ikprime, identity []byte) *EapAkaPrimeKeys {
+	key := append(append([]byte{}, ikprime...), ckprime...)
+	s := append([]byte("EAP-AKA'"), identity...)
+	mk := PrfPrime(key, s, 208)
+	return &EapAkaPrimeKeys{
+		KEncr: mk[0:16],
+		KAut:  mk[16:48],
+		KRe:   mk[48:80],
+		Msk:   mk[80:144],
+		Emsk:  mk[144:208],
+	}
+}
+
+// Kausf is the 256 most significant bits of EMSK (TS 33.501 6.1.3.1)
+func (k *EapAkaPrimeKeys) Kausf() []uint8 {
+	return k.Emsk[:32]
+}
+
+// an attribute which is not decoded into a field of EapAkaPrime; Value is
+// everything after the Type and Length octets
+type EapAkaAttribute struct {
+	Type  uint8
+	Value []uint8
+}
+
+// EAP-Request/Response of type AKA'
+type EapAkaPrime struct {
+	Code       uint8
+	Identifier uint8
+	Subtype    uint8
+	Rand       []uint8
+	Autn       []uint8
+	Res        []uint8
+	Auts       []uint8
+	Mac        []uint8
+	KdfInput   string
+	Kdf        []uint16
+	Others     []EapAkaAttribute
+}
+
+func appendAttribute(buf []uint8, t uint8, value []uint8) []uint8 {
+	l := (len(value) + 2 + 3) / 4
+	buf = append(buf, t, uint8(l))
+	buf = append(buf, value...)
+	for i := len(value) + 2; i < 4*l; i++ {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// Encode builds the EAP packet. AT_MAC is appended when kaut or p.Mac is
+// set: it is computed with kaut if given, otherwise p.Mac is copied as is.
+// p.Mac is updated with the encoded value.
+func (p *EapAkaPrime) Encode(kaut []uint8) (buf []uint8, err error) {
+	buf = []uint8{p.Code, p.Identifier, 0, 0, EAP_TYPE_AKA_PRIME, p.Subtype, 0, 0}
+	if p.Rand != nil {
+		if len(p.Rand) != 16 {
+			return nil, fmt.Errorf("Wrong RAND size")
+		}
+		buf = appendAttribute(buf, AT_RAND, append([]uint8{0, 0}, p.Rand...))
+	}
+	if p.Autn != nil {
+		if len(p.Autn) != 16 {
+			return nil, fmt.Errorf("Wrong AUTN size")
+		}
+		buf = appendAttribute(buf, AT_AUTN, append([]uint8{0, 0}, p.Autn...))
+	}
+	if p.Res != nil {
+		v := binary.BigEndian.AppendUint16(nil, uint16(8*len(p.Res)))
+		buf = appendAttribute(buf, AT_RES, append(v, p.Res...))
+	}
+	if p.Auts != nil {
+		if len(p.Auts) != 14 {
+			return nil, fmt.Errorf("Wrong AUTS size")
+		}
+		buf = appendAttribute(buf, AT_AUTS, p.Auts)
+	}
+	if len(p.KdfInput) > 0 {
+		v := binary.BigEndian.AppendUint16(nil, uint16(len(p.KdfInput)))
+		buf = appendAttribute(buf, AT_KDF_INPUT, append(v, p.KdfInput...))
+	}
+	for _, kdf := range p.Kdf {
+		buf = appendAttribute(buf, AT_KDF, binary.BigEndian.AppendUint16(nil, kdf))
+	}
+	for _, attr := range p.Others {
+		buf = appendAttribute(buf, attr.Type, attr.Value)
+	}
+	macOffset := -1
+	if p.Mac != nil || kaut != nil {
+		macOffset = len(buf) + 4
+		buf = appendAttribute(buf, AT_MAC, make([]uint8, 18))
+	}
+	if len(buf) > 0xffff {
+		return nil, fmt.Errorf("EAP packet is too long")
+	}
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(buf)))
+
+	if macOffset > 0 {
+		if kaut != nil {
+			copy(buf[macOffset:], EapAkaMac(kaut, buf))
+		} else if len(p.Mac) == 16 {
+			copy(buf[macOffset:], p.Mac)
+		}
+		p.Mac = append([]uint8{}, buf[macOffset:macOffset+16]...)
+	}
+	return
+}
+
+// DecodeEapAkaPrime parses an EAP-Request/Response of type AKA'
+func DecodeEapAkaPrime(buf []uint8) (p *EapAkaPrime, err error) {
+	if len(buf) < 8 || int(binary.BigEndian.Uint16(buf[2:])) != len(buf) {
+		return nil, fmt.Errorf("Wrong EAP packet length")
+	}
+	if buf[4] != EAP_TYPE_AKA_PRIME {
+		return nil, fmt.Errorf("Not an EAP-AKA' packet: type %d", buf[4])
+	}
+	p = &EapAkaPrime{
+		Code:       buf[0],
+		Identifier: buf[1],
+		Subtype:    buf[5],
+	}
+	for offset := 8; offset < len(buf); {
+		if offset+2 > len(buf) || buf[offset+1] == 0 || offset+4*int(buf[offset+1]) > len(buf) {
+			return nil, fmt.Errorf("Wrong attribute length at %d", offset)
+		}
+		t := buf[offset]
+		v := buf[offset+2 : offset+4*int(buf[offset+1])]
+		offset += 4 * int(buf[offset+1])
+		switch t {
+		case AT_RAND, AT_AUTN, AT_MAC:
+			if len(v) != 18 {
+				return nil, fmt.Errorf("Wrong size of attribute %d", t)
+			}
+			val := append([]uint8{}, v[2:]...)
+			switch t {
+			case AT_RAND:
+				p.Rand = val
+			case AT_AUTN:
+				p.Autn = val
+			default:
+				p.Mac = val
+			}
+		case AT_RES:
+			l := int(binary.BigEndian.Uint16(v)+7) / 8
+			if l+2 > len(v) {
+				return nil, fmt.Errorf("Wrong RES length")
+			}
+			p.Res = append([]uint8{}, v[2:2+l]...)
+		case AT_AUTS:
+			if len(v) != 14 {
+				return nil, fmt.Errorf("Wrong AUTS size")
+			}
+			p.Auts = append([]uint8{}, v...)
+		case AT_KDF_INPUT:
+			l := int(binary.BigEndian.Uint16(v))
+			if l+2 > len(v) {
+				return nil, fmt.Errorf("Wrong network name length")
+			}
+			p.KdfInput = string(v[2 : 2+l])
+		case AT_KDF:
+			p.Kdf = append(p.Kdf, binary.BigEndian.Uint16(v))
+		default:
+			//other attributes are kept as they are
+			p.Others = append(p.Others, EapAkaAttribute{
+				Type:  t,
+				Value: append([]uint8{}, v...),
+			})
+		}
+	}
+	return
+}
+
+// EapAkaMac computes AT_MAC (HMAC-SHA-256-128) over a packet whose MAC value
+// is zeroed
+func EapAkaMac(kaut []uint8, packet []uint8) []uint8 {
+	mac := hmac.New(sha256.New, kaut)
+	mac.Write(packet)
+	return mac.Sum(nil)[:16]
+}
+
+// VerifyEapAkaMac checks AT_MAC of an encoded EAP-AKA' packet
+func VerifyEapAkaMac(kaut []uint8, packet []uint8) error {
+	buf := append([]uint8{}, packet...)
+	for offset := 8; offset+2 <= len(buf) && buf[offset+1] > 0; offset += 4 * int(buf[offset+1]) {
+		if buf[offset] == AT_MAC && buf[offset+1] == 5 && offset+20 <= len(buf) {
+			received := append([]uint8{}, buf[offset+4:offset+20]...)
+			for i := offset + 4; i < offset+20; i++ {
+				buf[i] = 0
+			}
+			if !hmac.Equal(received, EapAkaMac(kaut, buf)) {
+				return fmt.Errorf("AT_MAC verification failed")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("AT_MAC is missing")
+}
@@ -0,0 +1,113 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestEapAkaPrimeKeys(t *testing.T) {
+	//RFC 5448 Appendix C, test case 1
+	CKPRIME, _ := hex.DecodeString("0093962d0dd84aa5684b045c9edffa04")
+	IKPRIME, _ := hex.DecodeString("ccfc230ca74fcc96c0a5d61164f5a76c")
+	keys := EapAkaPrimeKeysDerive(CKPRIME, IKPRIME, []byte("0555444333222111"))
+
+	expected := map[string]string{
+		"K_encr": "766fa0a6c317174b812d52fbcd11a179",
+		"K_aut":  "0842ea722ff6835bfa2032499fc3ec23c2f0e388b4f07543ffc677f1696d71ea",
+		"K_re":   "cf83aa8bc7e0aced892acc98e76a9b2095b558c7795c7094715cb3393aa7d17a",
+		"MSK":    "67c42d9aa56c1b79e295e3459fc3d187d42be0bf818d3070e362c5e967a4d544e8ecfe19358ab3039aff03b7c930588c055babee58a02650b067ec4e9347c75a",
+		"EMSK":   "f861703cd775590e16c7679ea3874ada866311de290764d760cf76df647ea01c313f69924bdd7650ca9bac141ea075c4ef9e8029c0e290cdbad5638b63bc23fb",
+	}
+	actual := map[string][]uint8{
+		"K_encr": keys.KEncr,
+		"K_aut":  keys.KAut,
+		"K_re":   keys.KRe,
+		"MSK":    keys.Msk,
+		"EMSK":   keys.Emsk,
+	}
+	for name, v := range expected {
+		if hex.EncodeToString(actual[name]) != v {
+			t.Errorf("wrong %s: %x", name, actual[name])
+		}
+	}
+	if !bytes.Equal(keys.Kausf(), keys.Emsk[:32]) {
+		t.Errorf("wrong KAUSF")
+	}
+}
+
+func TestEapAkaPrimeCodec(t *testing.T) {
+	RAND, _ := hex.DecodeString("81e92b6c0ee0e12ebceba8d92a99dfa5")
+	AUTN, _ := hex.DecodeString("bb52e91c747ac3ab2a5c23d15ee351d5")
+	RES, _ := hex.DecodeString("28d7b0f2a2ec3de5")
+	KAUT, _ := hex.DecodeString("0842ea722ff6835bfa2032499fc3ec23c2f0e388b4f07543ffc677f1696d71ea")
+
+	req := &EapAkaPrime{
+		Code:       EAP_CODE_REQUEST,
+		Identifier: 7,
+		Subtype:    AKA_SUBTYPE_CHALLENGE,
+		Rand:       RAND,
+		Autn:       AUTN,
+		KdfInput:   "WLAN",
+		Kdf:        []uint16{AKA_PRIME_KDF},
+	}
+	buf, err := req.Encode(KAUT)
+	if err != nil {
+		t.Fatalf("Encode failed: %+v", err)
+	}
+	if len(buf) != 8+20+20+8+4+20 {
+		t.Errorf("wrong packet length %d", len(buf))
+	}
+	if err = VerifyEapAkaMac(KAUT, buf); err != nil {
+		t.Errorf("MAC verification failed: %+v", err)
+	}
+	decoded, err := DecodeEapAkaPrime(buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %+v", err)
+	}
+	if !reflect.DeepEqual(req, decoded) {
+		t.Errorf("decoded packet mismatch: %+v", decoded)
+	}
+
+	buf[len(buf)-1] ^= 0x01
+	if err = VerifyEapAkaMac(KAUT, buf); err == nil {
+		t.Errorf("tampered packet must be rejected")
+	}
+
+	resp := &EapAkaPrime{
+		Code:       EAP_CODE_RESPONSE,
+		Identifier: 7,
+		Subtype:    AKA_SUBTYPE_CHALLENGE,
+		Res:        RES,
+	}
+	buf, _ = resp.Encode(KAUT)
+	if decoded, err = DecodeEapAkaPrime(buf); err != nil || !bytes.Equal(decoded.Res, RES) {
+		t.Errorf("wrong decoded RES: %+v", err)
+	}
+
+	sync := &EapAkaPrime{
+		Code:       EAP_CODE_RESPONSE,
+		Identifier: 8,
+		Subtype:    AKA_SUBTYPE_SYNCHRONIZATION_FAILURE,
+		Auts:       make([]uint8, 14),
+		Kdf:        []uint16{AKA_PRIME_KDF},
+	}
+	buf, _ = sync.Encode(nil)
+	if decoded, err = DecodeEapAkaPrime(buf); err != nil || !reflect.DeepEqual(sync, decoded) {
+		t.Errorf("wrong decoded synchronization failure: %+v", err)
+	}
+
+	reject := &EapAkaPrime{
+		Code:       EAP_CODE_RESPONSE,
+		Identifier: 9,
+		Subtype:    AKA_SUBTYPE_AUTHENTICATION_REJECT,
+	}
+	buf, _ = reject.Encode(nil)
+	if !bytes.Equal(buf, []uint8{2, 9, 0, 8, 50, 2, 0, 0}) {
+		t.Errorf("wrong authentication reject %x", buf)
+	}
+	if _, err = DecodeEapAkaPrime(buf[:6]); err == nil {
+		t.Errorf("truncated packet must be rejected")
+	}
+}
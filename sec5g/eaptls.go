@@ -0,0 +1,588 @@
+package sec5g
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// EAP-TLS (RFC 5216, RFC 9190) server and peer running crypto/tls over EAP
+// packets, used as primary authentication method (TS 33.501 Annex B)
+
+const (
+	EAP_TYPE_TLS uint8 = 13
+
+	EAP_TLS_FLAG_LENGTH uint8 = 0x80 //TLS Message Length included
+	EAP_TLS_FLAG_MORE   uint8 = 0x40 //more fragments
+	EAP_TLS_FLAG_START  uint8 = 0x20
+
+	EAP_TLS_DEFAULT_FRAGMENT_SIZE = 1024
+)
+
+const (
+	eapTlsMaxMessage = 1 << 16 //largest reassembled TLS data
+	eapTlsKeyLabel   = "EXPORTER_EAP_TLS_Key_Material"
+	eapTlsIdLabel    = "EXPORTER_EAP_TLS_Method-Id"
+	eapTls12KeyLabel = "client EAP encryption"
+)
+
+var ErrEapTlsFailure = errors.New("EAP-TLS authentication failed")
+
+// EapTlsPacket is an EAP-Request/Response of type EAP-TLS or an EAP
+// Success/Failure (Flags and Data are then unused)
+type EapTlsPacket struct {
+	Code       uint8
+	Identifier uint8
+	Flags      uint8
+	TlsLength  uint32 //total TLS data length, with EAP_TLS_FLAG_LENGTH
+	Data       []uint8
+}
+
+func (p *EapTlsPacket) Encode() []uint8 {
+	if p.Code == EAP_CODE_SUCCESS || p.Code == EAP_CODE_FAILURE {
+		return []uint8{p.Code, p.Identifier, 0, 4}
+	}
+	buf := []uint8{p.Code, p.Identifier, 0, 0, EAP_TYPE_TLS, p.Flags}
+	if p.Flags&EAP_TLS_FLAG_LENGTH != 0 {
+		buf = binary.BigEndian.AppendUint32(buf, p.TlsLength)
+	}
+	buf = append(buf, p.Data...)
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(buf)))
+	return buf
+}
+
+func DecodeEapTlsPacket(buf []uint8) (p *EapTlsPacket, err error) {
+	if len(buf) < 4 || int(binary.BigEndian.Uint16(buf[2:])) != len(buf) {
+		err = fmt.Errorf("Wrong EAP packet length")
+		return
+	}
+	p = &EapTlsPacket{
+		Code:       buf[0],
+		Identifier: buf[1],
+	}
+	switch p.Code {
+	case EAP_CODE_SUCCESS, EAP_CODE_FAILURE:
+		return
+	case EAP_CODE_REQUEST, EAP_CODE_RESPONSE:
+	default:
+		return nil, fmt.Errorf("Unknown EAP code %d", p.Code)
+	}
+	if len(buf) < 6 || buf[4] != EAP_TYPE_TLS {
+		return nil, fmt.Errorf("Not an EAP-TLS packet")
+	}
+	p.Flags = buf[5]
+	data := buf[6:]
+	if p.Flags&EAP_TLS_FLAG_LENGTH != 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("Missing TLS Message Length")
+		}
+		p.TlsLength = binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+	p.Data = append([]uint8{}, data...)
+	return
+}
+
+// keys exported from the TLS session (RFC 5216 2.3, RFC 9190 2.3)
+type EapTlsKeys struct {
+	Msk      []uint8 //512 bits
+	Emsk     []uint8 //512 bits
+	MethodId []uint8 //TLS 1.3 only
+}
+
+// Kausf is the 256 most significant bits of EMSK (TS 33.501 B.2.1.2)
+func (k *EapTlsKeys) Kausf() []uint8 {
+	return k.Emsk[:32]
+}
+
+func exportEapTlsKeys(state tls.ConnectionState) (keys *EapTlsKeys, err error) {
+	var material []uint8
+	keys = &EapTlsKeys{}
+	if state.Version == tls.VersionTLS13 {
+		//context is the EAP-TLS Type-Code
+		if material, err = state.ExportKeyingMaterial(eapTlsKeyLabel, []uint8{EAP_TYPE_TLS}, 128); err != nil {
+			return nil, err
+		}
+		if keys.MethodId, err = state.ExportKeyingMaterial(eapTlsIdLabel, []uint8{EAP_TYPE_TLS}, 64); err != nil {
+			return nil, err
+		}
+	} else if material, err = state.ExportKeyingMaterial(eapTls12KeyLabel, nil, 128); err != nil {
+		//TLS-PRF-128(master secret, label, client random || server random)
+		return nil, err
+	}
+	keys.Msk, keys.Emsk = material[:64], material[64:]
+	return
+}
+
+// net.Conn between crypto/tls and the EAP exchange: the TLS goroutine
+// blocks in Read once a flight has been written, the EAP side then collects
+// the flight and later hands over the next one from the other end
+type eapTlsConn struct {
+	in      []uint8
+	out     bytes.Buffer
+	input   chan []uint8
+	waiting chan struct{}
+	mutex   sync.Mutex
+}
+
+func (c *eapTlsConn) Read(b []byte) (int, error) {
+	if len(c.in) == 0 {
+		c.waiting <- struct{}{}
+		data, ok := <-c.input
+		if !ok {
+			return 0, io.EOF
+		}
+		c.in = data
+	}
+	n := copy(b, c.in)
+	c.in = c.in[n:]
+	return n, nil
+}
+
+func (c *eapTlsConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.out.Write(b)
+}
+
+func (c *eapTlsConn) takeOut() []uint8 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	out := append([]uint8{}, c.out.Bytes()...)
+	c.out.Reset()
+	return out
+}
+
+func (c *eapTlsConn) Close() error                       { return nil }
+func (c *eapTlsConn) LocalAddr() net.Addr                { return eapTlsAddr{} }
+func (c *eapTlsConn) RemoteAddr() net.Addr               { return eapTlsAddr{} }
+func (c *eapTlsConn) SetDeadline(t time.Time) error      { return nil }
+func (c *eapTlsConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *eapTlsConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type eapTlsAddr struct{}
+
+func (eapTlsAddr) Network() string { return "eap" }
+func (eapTlsAddr) String() string  { return "eap-tls" }
+
+// fragmentation, reassembly and the TLS goroutine shared by server and peer
+type eapTlsEngine struct {
+	conn     *eapTlsConn
+	tls      *tls.Conn
+	fragment int
+	running  bool
+	done     chan error
+	finished bool  //the TLS goroutine has returned
+	err      error //its result
+	rx       []uint8
+	rxLen    int //expected reassembled length, 0 if unknown
+	tx       []uint8
+	txFirst  bool //next fragment is the first one of tx
+}
+
+func newEapTlsEngine(fragment int) (*eapTlsEngine, error) {
+	if fragment == 0 {
+		fragment = EAP_TLS_DEFAULT_FRAGMENT_SIZE
+	}
+	if fragment < 64 {
+		return nil, fmt.Errorf("Fragment size %d is too small", fragment)
+	}
+	return &eapTlsEngine{
+		conn: &eapTlsConn{
+			input:   make(chan []uint8),
+			waiting: make(chan struct{}),
+		},
+		fragment: fragment,
+		done:     make(chan error, 1),
+	}, nil
+}
+
+// run the handshake (and what follows it) in the TLS goroutine then wait
+// for its first flight
+func (e *eapTlsEngine) start(run func() error) {
+	e.running = true
+	go func() {
+		e.done <- run()
+	}()
+	e.wait()
+}
+
+func (e *eapTlsEngine) wait() {
+	select {
+	case <-e.conn.waiting:
+	case e.err = <-e.done:
+		e.finished = true
+	}
+	e.tx = append(e.tx, e.conn.takeOut()...)
+	e.txFirst = true
+}
+
+// receive adds a fragment; once the TLS data is complete it is handed to the
+// TLS goroutine and its answer is collected. complete is false while more
+// fragments are expected.
+func (e *eapTlsEngine) receive(p *EapTlsPacket) (complete bool, err error) {
+	if len(e.tx) > 0 {
+		return false, fmt.Errorf("Unexpected TLS data while sending")
+	}
+	if p.Flags&EAP_TLS_FLAG_LENGTH != 0 {
+		if len(e.rx) == 0 {
+			e.rxLen = int(p.TlsLength)
+		} else if int(p.TlsLength) != e.rxLen {
+			return false, fmt.Errorf("TLS Message Length changed")
+		}
+		if e.rxLen > eapTlsMaxMessage {
+			return false, fmt.Errorf("TLS message is too long")
+		}
+	}
+	e.rx = append(e.rx, p.Data...)
+	if len(e.rx) > eapTlsMaxMessage || (e.rxLen > 0 && len(e.rx) > e.rxLen) {
+		return false, fmt.Errorf("TLS message is too long")
+	}
+	if p.Flags&EAP_TLS_FLAG_MORE != 0 {
+		return false, nil
+	}
+	if e.rxLen > 0 && len(e.rx) != e.rxLen {
+		return false, fmt.Errorf("TLS message is truncated")
+	}
+	data := e.rx
+	e.rx, e.rxLen = nil, 0
+	if !e.running || e.finished {
+		return false, fmt.Errorf("Unexpected TLS data")
+	}
+	e.conn.input <- data
+	e.wait()
+	return true, nil
+}
+
+// nextFragment builds the flags and data of the next packet to send
+func (e *eapTlsEngine) nextFragment() (p *EapTlsPacket) {
+	p = &EapTlsPacket{}
+	n := len(e.tx)
+	if n > e.fragment {
+		n = e.fragment
+		p.Flags |= EAP_TLS_FLAG_MORE
+		if e.txFirst {
+			p.Flags |= EAP_TLS_FLAG_LENGTH
+			p.TlsLength = uint32(len(e.tx))
+		}
+	}
+	p.Data = e.tx[:n]
+	e.tx = e.tx[n:]
+	e.txFirst = false
+	return
+}
+
+func (e *eapTlsEngine) close() {
+	if e.running && !e.finished {
+		close(e.conn.input)
+		e.err = <-e.done
+		e.finished = true
+	}
+}
+
+func isEmptyEapTls(p *EapTlsPacket) bool {
+	return len(p.Data) == 0 && p.Flags&(EAP_TLS_FLAG_MORE|EAP_TLS_FLAG_START) == 0
+}
+
+// EapTlsServer runs the EAP server side: Start builds the first request and
+// Handle answers each peer response with the next request or with an EAP
+// Success/Failure. Session tickets are disabled (no resumption).
+type EapTlsServer struct {
+	engine     *eapTlsEngine
+	config     *tls.Config
+	identifier uint8 //of the last request
+	failing    bool  //a TLS alert is being sent, EAP-Failure follows
+	keys       *EapTlsKeys
+	result     uint8   //EAP_CODE_SUCCESS or EAP_CODE_FAILURE once over
+	last       []uint8 //last packet sent
+	answered   []uint8 //response the last packet answers
+}
+
+// NewEapTlsServer creates a server with a TLS configuration holding the
+// server certificate (and client certificate verification) and a maximum
+// TLS data size per packet (0 for the default)
+func NewEapTlsServer(config *tls.Config, fragment int) (s *EapTlsServer, err error) {
+	if config == nil {
+		err = fmt.Errorf("Missing TLS configuration")
+		return
+	}
+	s = &EapTlsServer{
+		config: config.Clone(),
+	}
+	s.config.SessionTicketsDisabled = true
+	if s.engine, err = newEapTlsEngine(fragment); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Start returns the EAP-TLS Start request
+func (s *EapTlsServer) Start(identifier uint8) []uint8 {
+	s.identifier = identifier
+	p := &EapTlsPacket{
+		Code:       EAP_CODE_REQUEST,
+		Identifier: identifier,
+		Flags:      EAP_TLS_FLAG_START,
+	}
+	return p.Encode()
+}
+
+func (s *EapTlsServer) request(p *EapTlsPacket) []uint8 {
+	s.identifier++
+	p.Code = EAP_CODE_REQUEST
+	p.Identifier = s.identifier
+	return p.Encode()
+}
+
+func (s *EapTlsServer) conclude(code uint8) []uint8 {
+	s.result = code
+	s.engine.close()
+	p := &EapTlsPacket{
+		Code:       code,
+		Identifier: s.identifier,
+	}
+	return p.Encode()
+}
+
+// Handle processes a peer response and returns the next packet to send. An
+// EAP-Failure packet is returned along with ErrEapTlsFailure. A retransmitted
+// response gets the last packet again (RFC 3748 4.3).
+func (s *EapTlsServer) Handle(response []uint8) (packet []uint8, err error) {
+	if s.last != nil && bytes.Equal(response, s.answered) {
+		if s.result == EAP_CODE_FAILURE {
+			err = ErrEapTlsFailure
+		}
+		return s.last, err
+	}
+	if packet, err = s.handle(response); packet != nil {
+		s.last, s.answered = packet, append([]uint8{}, response...)
+	}
+	return
+}
+
+func (s *EapTlsServer) handle(response []uint8) (packet []uint8, err error) {
+	if s.result != 0 {
+		return nil, fmt.Errorf("EAP-TLS session is over")
+	}
+	var p *EapTlsPacket
+	if p, err = DecodeEapTlsPacket(response); err != nil {
+		return
+	}
+	if p.Code != EAP_CODE_RESPONSE || p.Identifier != s.identifier {
+		return nil, fmt.Errorf("Unexpected EAP packet code %d identifier %d", p.Code, p.Identifier)
+	}
+
+	if isEmptyEapTls(p) {
+		//acknowledgement of a fragment or of the last flight
+		switch {
+		case len(s.engine.tx) > 0:
+			return s.request(s.engine.nextFragment()), nil
+		case s.failing || (s.engine.finished && s.engine.err != nil):
+			return s.conclude(EAP_CODE_FAILURE), ErrEapTlsFailure
+		case s.engine.finished:
+			if s.keys, err = exportEapTlsKeys(s.engine.tls.ConnectionState()); err != nil {
+				return s.conclude(EAP_CODE_FAILURE), err
+			}
+			return s.conclude(EAP_CODE_SUCCESS), nil
+		}
+		return nil, fmt.Errorf("Unexpected acknowledgement")
+	}
+
+	if !s.engine.running {
+		s.engine.tls = tls.Server(s.engine.conn, s.config)
+		s.engine.start(func() error {
+			if err := s.engine.tls.Handshake(); err != nil {
+				return err
+			}
+			if s.engine.tls.ConnectionState().Version == tls.VersionTLS13 {
+				//commitment message: no more handshake messages follow
+				_, err := s.engine.tls.Write([]uint8{0x00})
+				return err
+			}
+			return nil
+		})
+	}
+	var complete bool
+	if complete, err = s.engine.receive(p); err != nil {
+		return s.conclude(EAP_CODE_FAILURE), err
+	}
+	if !complete {
+		return s.request(&EapTlsPacket{}), nil
+	}
+	if s.engine.finished && s.engine.err != nil {
+		//send the alert first if there is one
+		if len(s.engine.tx) == 0 {
+			return s.conclude(EAP_CODE_FAILURE), ErrEapTlsFailure
+		}
+		s.failing = true
+	}
+	if len(s.engine.tx) == 0 {
+		return s.conclude(EAP_CODE_FAILURE), fmt.Errorf("No TLS data to send")
+	}
+	return s.request(s.engine.nextFragment()), nil
+}
+
+// Keys returns the exported keys once EAP-Success has been sent
+func (s *EapTlsServer) Keys() (*EapTlsKeys, error) {
+	if s.result != EAP_CODE_SUCCESS {
+		return nil, fmt.Errorf("EAP-TLS has not succeeded")
+	}
+	return s.keys, nil
+}
+
+// ConnectionState of the TLS session (peer certificates, version, ...)
+func (s *EapTlsServer) ConnectionState() tls.ConnectionState {
+	if s.engine.tls == nil {
+		return tls.ConnectionState{}
+	}
+	return s.engine.tls.ConnectionState()
+}
+
+// HandshakeError returns the TLS handshake error, if any
+func (s *EapTlsServer) HandshakeError() error {
+	return s.engine.err
+}
+
+// Close stops the TLS goroutine of an unfinished session
+func (s *EapTlsServer) Close() {
+	s.engine.close()
+}
+
+// EapTlsPeer runs the EAP peer side, e.g. for UE simulators and tests
+type EapTlsPeer struct {
+	engine     *eapTlsEngine
+	config     *tls.Config
+	keys       *EapTlsKeys
+	result     uint8
+	last       []uint8 //last response sent
+	identifier uint8   //of the request it answers
+}
+
+func NewEapTlsPeer(config *tls.Config, fragment int) (p *EapTlsPeer, err error) {
+	if config == nil {
+		err = fmt.Errorf("Missing TLS configuration")
+		return
+	}
+	p = &EapTlsPeer{
+		config: config.Clone(),
+	}
+	if p.engine, err = newEapTlsEngine(fragment); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Handle processes a server packet and returns the response; nil is
+// returned for EAP-Success, ErrEapTlsFailure for EAP-Failure. A retransmitted
+// request (same Identifier as the last answered one) gets the last response
+// again without being processed (RFC 3748 4.3).
+func (peer *EapTlsPeer) Handle(request []uint8) (response []uint8, err error) {
+	if peer.result != 0 {
+		return nil, fmt.Errorf("EAP-TLS session is over")
+	}
+	var p *EapTlsPacket
+	if p, err = DecodeEapTlsPacket(request); err != nil {
+		return
+	}
+	if peer.last != nil && p.Code == EAP_CODE_REQUEST && p.Identifier == peer.identifier {
+		return peer.last, nil
+	}
+	if response, err = peer.handle(p); response != nil {
+		peer.last, peer.identifier = response, p.Identifier
+	}
+	return
+}
+
+func (peer *EapTlsPeer) handle(p *EapTlsPacket) (response []uint8, err error) {
+	switch p.Code {
+	case EAP_CODE_SUCCESS:
+		if !peer.engine.finished || peer.engine.err != nil || len(peer.engine.tx) > 0 {
+			return nil, fmt.Errorf("Unexpected EAP-Success")
+		}
+		if peer.keys, err = exportEapTlsKeys(peer.engine.tls.ConnectionState()); err != nil {
+			return
+		}
+		peer.result = EAP_CODE_SUCCESS
+		return nil, nil
+	case EAP_CODE_FAILURE:
+		peer.result = EAP_CODE_FAILURE
+		peer.engine.close()
+		return nil, ErrEapTlsFailure
+	case EAP_CODE_RESPONSE:
+		return nil, fmt.Errorf("Unexpected EAP response")
+	}
+
+	answer := func(a *EapTlsPacket) []uint8 {
+		a.Code = EAP_CODE_RESPONSE
+		a.Identifier = p.Identifier
+		return a.Encode()
+	}
+	switch {
+	case p.Flags&EAP_TLS_FLAG_START != 0:
+		if peer.engine.running {
+			return nil, fmt.Errorf("Unexpected EAP-TLS Start")
+		}
+		peer.engine.tls = tls.Client(peer.engine.conn, peer.config)
+		peer.engine.start(func() error {
+			if err := peer.engine.tls.Handshake(); err != nil {
+				return err
+			}
+			if peer.engine.tls.ConnectionState().Version == tls.VersionTLS13 {
+				//wait for the commitment message
+				var b [1]uint8
+				if _, err := io.ReadFull(peer.engine.tls, b[:]); err != nil {
+					return err
+				}
+				if b[0] != 0x00 {
+					return fmt.Errorf("Invalid commitment message")
+				}
+			}
+			return nil
+		})
+	case isEmptyEapTls(p):
+		if len(peer.engine.tx) == 0 {
+			return nil, fmt.Errorf("Unexpected acknowledgement")
+		}
+	default:
+		var complete bool
+		if complete, err = peer.engine.receive(p); err != nil {
+			return
+		}
+		if !complete {
+			return answer(&EapTlsPacket{}), nil
+		}
+	}
+	if len(peer.engine.tx) == 0 {
+		//acknowledge the last server flight
+		return answer(&EapTlsPacket{}), nil
+	}
+	return answer(peer.engine.nextFragment()), nil
+}
+
+func (peer *EapTlsPeer) Keys() (*EapTlsKeys, error) {
+	if peer.result != EAP_CODE_SUCCESS {
+		return nil, fmt.Errorf("EAP-TLS has not succeeded")
+	}
+	return peer.keys, nil
+}
+
+func (peer *EapTlsPeer) ConnectionState() tls.ConnectionState {
+	if peer.engine.tls == nil {
+		return tls.ConnectionState{}
+	}
+	return peer.engine.tls.ConnectionState()
+}
+
+func (peer *EapTlsPeer) HandshakeError() error {
+	return peer.engine.err
+}
+
+func (peer *EapTlsPeer) Close() {
+	peer.engine.close()
+}
@@ -0,0 +1,307 @@
+package sec5g
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type eapTlsTestPki struct {
+	pool   *x509.CertPool
+	server tls.Certificate
+	client tls.Certificate
+}
+
+func newEapTlsTestCert(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %+v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert, key
+}
+
+func newEapTlsTestPki(t *testing.T) *eapTlsTestPki {
+	now := time.Now()
+	_, ca, caKey := newEapTlsTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	pki := &eapTlsTestPki{pool: x509.NewCertPool()}
+	pki.pool.AddCert(ca)
+	pki.server, _, _ = newEapTlsTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ausf.example.com"},
+		DNSNames:     []string{"ausf.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	pki.client, _, _ = newEapTlsTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "imsi-208930000000001"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	return pki
+}
+
+// run the exchange until EAP-Success/Failure; returns the number of round
+// trips. With retransmit, every packet is delivered twice and must get the
+// same answer.
+func runEapTls(t *testing.T, server *EapTlsServer, peer *EapTlsPeer, retransmit bool) (rounds int, serverErr, peerErr error) {
+	packet := server.Start(7)
+	for rounds = 0; rounds < 100; rounds++ {
+		var response []uint8
+		if response, peerErr = peer.Handle(packet); response == nil {
+			return
+		}
+		if peerErr != nil {
+			t.Fatalf("peer failed: %+v", peerErr)
+		}
+		if retransmit {
+			if again, err := peer.Handle(packet); err != nil || !bytes.Equal(again, response) {
+				t.Fatalf("retransmitted request got a different response: %+v", err)
+			}
+		}
+		if packet, serverErr = server.Handle(response); retransmit {
+			if again, _ := server.Handle(response); !bytes.Equal(again, packet) {
+				t.Fatalf("retransmitted response got a different packet")
+			}
+		}
+		if serverErr != nil {
+			_, peerErr = peer.Handle(packet)
+			return
+		}
+	}
+	t.Fatalf("EAP-TLS does not end")
+	return
+}
+
+func TestEapTls(t *testing.T) {
+	pki := newEapTlsTestPki(t)
+	for _, version := range []uint16{tls.VersionTLS13, tls.VersionTLS12} {
+		for _, fragment := range []int{0, 100} {
+			server, _ := NewEapTlsServer(&tls.Config{
+				Certificates: []tls.Certificate{pki.server},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    pki.pool,
+				MinVersion:   version,
+				MaxVersion:   version,
+			}, fragment)
+			peer, _ := NewEapTlsPeer(&tls.Config{
+				Certificates: []tls.Certificate{pki.client},
+				RootCAs:      pki.pool,
+				ServerName:   "ausf.example.com",
+			}, fragment)
+
+			rounds, serverErr, peerErr := runEapTls(t, server, peer, fragment != 0)
+			if serverErr != nil || peerErr != nil {
+				t.Fatalf("TLS %x fragment %d failed: %+v %+v", version, fragment, serverErr, peerErr)
+			}
+			if fragment != 0 && rounds < 10 {
+				t.Errorf("TLS %x: messages are not fragmented (%d rounds)", version, rounds)
+			}
+			if state := server.ConnectionState(); state.Version != version || len(state.PeerCertificates) != 1 {
+				t.Errorf("wrong TLS session %x", state.Version)
+			}
+			serverKeys, err := server.Keys()
+			if err != nil {
+				t.Fatalf("server keys: %+v", err)
+			}
+			peerKeys, err := peer.Keys()
+			if err != nil {
+				t.Fatalf("peer keys: %+v", err)
+			}
+			for _, keys := range []*EapTlsKeys{serverKeys, peerKeys} {
+				if len(keys.Msk) != 64 || len(keys.Emsk) != 64 {
+					t.Errorf("TLS %x: wrong MSK/EMSK sizes %d %d", version, len(keys.Msk), len(keys.Emsk))
+				}
+				//RFC 9190 2.3: the Method-Id is only defined for TLS 1.3
+				if (version == tls.VersionTLS13 && len(keys.MethodId) != 64) || (version == tls.VersionTLS12 && keys.MethodId != nil) {
+					t.Errorf("TLS %x: wrong Method-Id %x", version, keys.MethodId)
+				}
+				if len(keys.Kausf()) != 32 || !bytes.Equal(keys.Kausf(), keys.Emsk[:32]) {
+					t.Errorf("TLS %x: KAUSF is not the first 256 bits of EMSK", version)
+				}
+			}
+			if !bytes.Equal(serverKeys.Msk, peerKeys.Msk) || !bytes.Equal(serverKeys.Emsk, peerKeys.Emsk) ||
+				!bytes.Equal(serverKeys.MethodId, peerKeys.MethodId) {
+				t.Errorf("TLS %x: keys differ", version)
+			}
+
+			//MSK || EMSK = TLS-Exporter/TLS-PRF over the session
+			var expected []uint8
+			state := server.ConnectionState()
+			if version == tls.VersionTLS13 {
+				expected, _ = state.ExportKeyingMaterial("EXPORTER_EAP_TLS_Key_Material", []uint8{0x0d}, 128)
+			} else {
+				expected, _ = state.ExportKeyingMaterial("client EAP encryption", nil, 128)
+			}
+			if !bytes.Equal(append(serverKeys.Msk, serverKeys.Emsk...), expected) {
+				t.Errorf("TLS %x: wrong key material", version)
+			}
+			if _, err = server.Handle(nil); err == nil {
+				t.Errorf("finished session must reject packets")
+			}
+		}
+	}
+}
+
+func TestEapTlsFailure(t *testing.T) {
+	pki := newEapTlsTestPki(t)
+	server, _ := NewEapTlsServer(&tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.pool,
+	}, 0)
+	//no client certificate
+	peer, _ := NewEapTlsPeer(&tls.Config{
+		RootCAs:    pki.pool,
+		ServerName: "ausf.example.com",
+	}, 0)
+	_, serverErr, peerErr := runEapTls(t, server, peer, false)
+	if serverErr == nil || peerErr != ErrEapTlsFailure || server.HandshakeError() == nil {
+		t.Errorf("missing client certificate must fail: %+v %+v", serverErr, peerErr)
+	}
+	if _, err := server.Keys(); err == nil {
+		t.Errorf("failed session must not export keys")
+	}
+
+	//untrusted server
+	server, _ = NewEapTlsServer(&tls.Config{Certificates: []tls.Certificate{pki.server}}, 0)
+	peer, _ = NewEapTlsPeer(&tls.Config{ServerName: "ausf.example.com", RootCAs: x509.NewCertPool()}, 0)
+	_, serverErr, peerErr = runEapTls(t, server, peer, true)
+	if serverErr == nil || peerErr != ErrEapTlsFailure || peer.HandshakeError() == nil {
+		t.Errorf("untrusted server must fail: %+v %+v", serverErr, peerErr)
+	}
+
+	//abandoned session
+	server, _ = NewEapTlsServer(&tls.Config{Certificates: []tls.Certificate{pki.server}}, 0)
+	peer, _ = NewEapTlsPeer(&tls.Config{RootCAs: pki.pool, ServerName: "ausf.example.com"}, 0)
+	response, _ := peer.Handle(server.Start(1))
+	request, err := server.Handle(response)
+	if err != nil {
+		t.Fatalf("server failed: %+v", err)
+	}
+	if again, err := server.Handle(response); err != nil || !bytes.Equal(again, request) {
+		t.Errorf("retransmitted response must get the last request: %+v", err)
+	}
+	response[1] += 5
+	if _, err = server.Handle(response); err == nil {
+		t.Errorf("wrong identifier must be rejected")
+	}
+	server.Close()
+	peer.Close()
+}
+
+func TestEapTlsFragmentError(t *testing.T) {
+	pki := newEapTlsTestPki(t)
+	newPair := func() (*EapTlsServer, *EapTlsPeer) {
+		server, _ := NewEapTlsServer(&tls.Config{
+			Certificates: []tls.Certificate{pki.server},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pki.pool,
+		}, 100)
+		peer, _ := NewEapTlsPeer(&tls.Config{
+			Certificates: []tls.Certificate{pki.client},
+			RootCAs:      pki.pool,
+			ServerName:   "ausf.example.com",
+		}, 100)
+		return server, peer
+	}
+	//the failure ends both sides
+	fail := func(name string, server *EapTlsServer, peer *EapTlsPeer, response []uint8) {
+		packet, err := server.Handle(response)
+		if err == nil || packet == nil || packet[0] != EAP_CODE_FAILURE {
+			t.Errorf("%s: EAP-Failure expected: %+v", name, err)
+			return
+		}
+		if _, err = peer.Handle(packet); err != ErrEapTlsFailure {
+			t.Errorf("%s: peer must fail: %+v", name, err)
+		}
+		if _, err = server.Keys(); err == nil {
+			t.Errorf("%s: failed session must not export keys", name)
+		}
+		server.Close()
+		peer.Close()
+	}
+
+	//TLS Message Length changes in the middle of the ClientHello fragments
+	server, peer := newPair()
+	response, _ := peer.Handle(server.Start(1))
+	if p, _ := DecodeEapTlsPacket(response); p.Flags&EAP_TLS_FLAG_MORE == 0 {
+		t.Fatalf("ClientHello is not fragmented")
+	}
+	ack, err := server.Handle(response)
+	if err != nil {
+		t.Fatalf("server failed: %+v", err)
+	}
+	response, _ = peer.Handle(ack)
+	p, _ := DecodeEapTlsPacket(response)
+	p.Flags |= EAP_TLS_FLAG_LENGTH
+	p.TlsLength = 1000
+	fail("length change", server, peer, p.Encode())
+
+	//TLS data instead of an acknowledgement while the server flight is
+	//being fragmented
+	server, peer = newPair()
+	packet := server.Start(1)
+	for i := 0; ; i++ {
+		if response, err = peer.Handle(packet); err != nil || i == 20 {
+			t.Fatalf("server flight is not fragmented: %+v", err)
+		}
+		if p, _ = DecodeEapTlsPacket(packet); p.Flags&EAP_TLS_FLAG_MORE != 0 && len(p.Data) > 0 && i > 2 {
+			break
+		}
+		packet, _ = server.Handle(response)
+	}
+	p = &EapTlsPacket{Code: EAP_CODE_RESPONSE, Identifier: p.Identifier, Data: []uint8{0x16, 0x03, 0x03}}
+	fail("data while sending", server, peer, p.Encode())
+}
+
+func TestEapTlsPacket(t *testing.T) {
+	p := &EapTlsPacket{
+		Code:       EAP_CODE_REQUEST,
+		Identifier: 3,
+		Flags:      EAP_TLS_FLAG_LENGTH | EAP_TLS_FLAG_MORE,
+		TlsLength:  1000,
+		Data:       []uint8{0x16, 0x03, 0x03},
+	}
+	buf := p.Encode()
+	if !bytes.Equal(buf, []uint8{1, 3, 0, 13, 13, 0xc0, 0, 0, 0x03, 0xe8, 0x16, 0x03, 0x03}) {
+		t.Errorf("wrong encoding %x", buf)
+	}
+	decoded, err := DecodeEapTlsPacket(buf)
+	if err != nil || decoded.TlsLength != 1000 || decoded.Flags != p.Flags || !bytes.Equal(decoded.Data, p.Data) {
+		t.Errorf("wrong decoding %+v %+v", decoded, err)
+	}
+	success := (&EapTlsPacket{Code: EAP_CODE_SUCCESS, Identifier: 9}).Encode()
+	if !bytes.Equal(success, []uint8{3, 9, 0, 4}) {
+		t.Errorf("wrong EAP-Success %x", success)
+	}
+	for _, bad := range [][]uint8{{1, 1, 0, 5}, {1, 1, 0, 6, 50, 0}, {1, 1, 0, 8, 13, 0x80, 0, 0}, {9, 1, 0, 4}} {
+		if _, err = DecodeEapTlsPacket(bad); err == nil {
+			t.Errorf("%x must be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package sec5g
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SUCI protection schemes (TS 33.501 Annex C)
+const (
+	SUCI_SCHEME_NULL      uint8 = 0
+	SUCI_SCHEME_PROFILE_A uint8 = 1 //X25519, AES-128-CTR, HMAC-SHA-256
+	SUCI_SCHEME_PROFILE_B uint8 = 2 //secp256r1, AES-128-CTR, HMAC-SHA-256
+)
+
+const (
+	eciesEncKeyLen = 16
+	eciesIcbLen    = 16
+	eciesMacKeyLen = 32
+	eciesMacLen    = 8
+)
+
+func eciesCurve(scheme uint8) (ecdh.Curve, error) {
+	switch scheme {
+	case SUCI_SCHEME_PROFILE_A:
+		return ecdh.X25519(), nil
+	case SUCI_SCHEME_PROFILE_B:
+		return ecdh.P256(), nil
+	}
+	return nil, fmt.Errorf("Unsupported protection scheme %d", scheme)
+}
+
+// length of the ephemeral public key in a scheme output
+func eciesPubLen(scheme uint8) int {
+	if scheme == SUCI_SCHEME_PROFILE_B {
+		return 33 //compressed point
+	}
+	return 32
+}
+
+// parse a public key; profile B keys can be compressed or uncompressed
+func eciesPublicKey(scheme uint8, pub []byte) (*ecdh.PublicKey, error) {
+	curve, err := eciesCurve(scheme)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == SUCI_SCHEME_PROFILE_B && len(pub) == 33 {
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), pub)
+		if x == nil {
+			return nil, fmt.Errorf("Invalid compressed public key")
+		}
+		pub = elliptic.Marshal(elliptic.P256(), x, y)
+	}
+	return curve.NewPublicKey(pub)
+}
+
+// encode a public key the way it is carried in the scheme output
+func eciesEncodePublicKey(scheme uint8, pub *ecdh.PublicKey) []byte {
+	b := pub.Bytes()
+	if scheme == SUCI_SCHEME_PROFILE_B {
+		//04 || X || Y => 02/03 || X
+		return append([]byte{0x02 | b[64]&0x01}, b[1:33]...)
+	}
+	return b
+}
+
+// EciesPublicKey returns the home network public key of a private key, in
+// compressed form for profile B
+func EciesPublicKey(scheme uint8, priv []byte) (pub []byte, err error) {
+	var curve ecdh.Curve
+	if curve, err = eciesCurve(scheme); err != nil {
+		return
+	}
+	var key *ecdh.PrivateKey
+	if key, err = curve.NewPrivateKey(priv); err != nil {
+		return
+	}
+	pub = eciesEncodePublicKey(scheme, key.PublicKey())
+	return
+}
+
+// ANSI-X9.63-KDF with SHA-256, the shared info is the ephemeral public key
+func x963Kdf(z, info []byte, size int) []byte {
+	out := make([]byte, 0, size+sha256.Size)
+	var counter [4]byte
+	for i := uint32(1); len(out) < size; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		h := sha256.New()
+		h.Write(z)
+		h.Write(counter[:])
+		h.Write(info)
+		out = h.Sum(out)
+	}
+	return out[:size]
+}
+
+// encrypt or decrypt with the keys derived from a shared secret, returning
+// the output text and the MAC tag over the ciphertext
+func eciesCrypt(z, ephpub, in []byte, encrypt bool) (out []byte, tag []byte, err error) {
+	keys := x963Kdf(z, ephpub, eciesEncKeyLen+eciesIcbLen+eciesMacKeyLen)
+	enckey := keys[:eciesEncKeyLen]
+	icb := keys[eciesEncKeyLen : eciesEncKeyLen+eciesIcbLen]
+	mackey := keys[eciesEncKeyLen+eciesIcbLen:]
+
+	var block cipher.Block
+	if block, err = aes.NewCipher(enckey); err != nil {
+		return
+	}
+	out = make([]byte, len(in))
+	cipher.NewCTR(block, icb).XORKeyStream(out, in)
+
+	mac := hmac.New(sha256.New, mackey)
+	if encrypt {
+		mac.Write(out)
+	} else {
+		mac.Write(in)
+	}
+	tag = mac.Sum(nil)[:eciesMacLen]
+	return
+}
+
+// SuciDeconceal recovers the scheme input (e.g. the BCD encoded MSIN) from a
+// scheme output (ephemeral public key || ciphertext || MAC tag) with the home
+// network private key (TS 33.501 C.3.3)
+func SuciDeconceal(scheme uint8, hnpriv []byte, output []byte) (plain []byte, err error) {
+	var curve ecdh.Curve
+	if curve, err = eciesCurve(scheme); err != nil {
+		return
+	}
+	publen := eciesPubLen(scheme)
+	if len(output) <= publen+eciesMacLen {
+		err = fmt.Errorf("Scheme output is too short")
+		return
+	}
+	ephraw := output[:publen]
+	ciphertext := output[publen : len(output)-eciesMacLen]
+	received := output[len(output)-eciesMacLen:]
+
+	var priv *ecdh.PrivateKey
+	if priv, err = curve.NewPrivateKey(hnpriv); err != nil {
+		return
+	}
+	var ephpub *ecdh.PublicKey
+	if ephpub, err = eciesPublicKey(scheme, ephraw); err != nil {
+		return
+	}
+	var z []byte
+	if z, err = priv.ECDH(ephpub); err != nil {
+		return
+	}
+	var tag []byte
+	if plain, tag, err = eciesCrypt(z, ephraw, ciphertext, false); err != nil {
+		return
+	}
+	if !hmac.Equal(tag, received) {
+		plain = nil
+		err = fmt.Errorf("MAC failed: calculated MAC=%x, received MAC=%x", tag, received)
+	}
+	return
+}
+
+// SuciConceal protects a scheme input with a fresh ephemeral key (TS 33.501
+// C.3.2)
+func SuciConceal(scheme uint8, hnpub []byte, plain []byte) (output []byte, err error) {
+	output, err = SuciConcealEx(scheme, hnpub, plain, rand.Reader)
+	return
+}
+
+// with customized rand reader for the ephemeral key
+func SuciConcealEx(scheme uint8, hnpub []byte, plain []byte, r io.Reader) (output []byte, err error) {
+	var curve ecdh.Curve
+	if curve, err = eciesCurve(scheme); err != nil {
+		return
+	}
+	var ephpriv [32]byte
+	for {
+		if _, err = io.ReadFull(r, ephpriv[:]); err != nil {
+			return
+		}
+		//retry on scalars out of the P-256 range
+		if _, err = curve.NewPrivateKey(ephpriv[:]); err == nil {
+			break
+		}
+	}
+	output, err = SuciConcealWithKey(scheme, hnpub, ephpriv[:], plain)
+	return
+}
+
+// SuciConcealWithKey protects a scheme input with the given ephemeral
+// private key
+func SuciConcealWithKey(scheme uint8, hnpub []byte, ephpriv []byte, plain []byte) (output []byte, err error) {
+	var curve ecdh.Curve
+	if curve, err = eciesCurve(scheme); err != nil {
+		return
+	}
+	var pub *ecdh.PublicKey
+	if pub, err = eciesPublicKey(scheme, hnpub); err != nil {
+		return
+	}
+	var priv *ecdh.PrivateKey
+	if priv, err = curve.NewPrivateKey(ephpriv); err != nil {
+		return
+	}
+	var z []byte
+	if z, err = priv.ECDH(pub); err != nil {
+		return
+	}
+	ephraw := eciesEncodePublicKey(scheme, priv.PublicKey())
+	var ciphertext, tag []byte
+	if ciphertext, tag, err = eciesCrypt(z, ephraw, plain, true); err != nil {
+		return
+	}
+	output = append(append(ephraw, ciphertext...), tag...)
+	return
+}
@@ -0,0 +1,77 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+type EciesTestCase struct {
+	Scheme  uint8
+	HnPriv  string
+	HnPub   string
+	EphPriv string
+	Plain   string
+	Output  string
+}
+
+func TestEcies(t *testing.T) {
+	//TS 33.501 C.4.3 and C.4.4
+	table := []EciesTestCase{
+		{
+			Scheme:  SUCI_SCHEME_PROFILE_A,
+			HnPriv:  "c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d",
+			HnPub:   "5a8d38864820197c3394b92613b20b91633cbd897119273bf8e4a6f4eec0a650",
+			EphPriv: "c80949f13ebe61af4ebdbd293ea4f942696b9e815d7e8f0096bbf6ed7de62256",
+			Plain:   "00012080f6",
+			Output:  "b2e92f836055a255837debf850b528997ce0201cb82adfe4be1f587d07d8457dcb02352410cddd9e730ef3fa87",
+		},
+		{
+			Scheme:  SUCI_SCHEME_PROFILE_B,
+			HnPriv:  "F1AB1074477EBCC7F554EA1C5FC368B1616730155E0041AC447D6301975FECDA",
+			HnPub:   "0272DA71976234CE833A6907425867B82E074D44EF907DFB4B3E21C1C2256EBCD1",
+			EphPriv: "99798858A1DC6A2C68637149A4B1DBFD1FDFF5ADDD62A2142F06699ED7602529",
+			Plain:   "00012080F6",
+			Output:  "039AAB8376597021E855679A9778EA0B67396E68C66DF32C0F41E9ACCA2DA9B9D146A33FC2716AC7DAE96AA30A4D",
+		},
+	}
+	for i, tc := range table {
+		hnpriv, _ := hex.DecodeString(tc.HnPriv)
+		hnpub, _ := hex.DecodeString(tc.HnPub)
+		ephpriv, _ := hex.DecodeString(tc.EphPriv)
+		plain, _ := hex.DecodeString(tc.Plain)
+		output, _ := hex.DecodeString(tc.Output)
+
+		if pub, err := EciesPublicKey(tc.Scheme, hnpriv); err != nil || !bytes.Equal(pub, hnpub) {
+			t.Errorf("[%d] wrong public key %x: %v", i, pub, err)
+		}
+		out, err := SuciConcealWithKey(tc.Scheme, hnpub, ephpriv, plain)
+		if err != nil {
+			t.Fatalf("[%d] conceal failed: %+v", i, err)
+		}
+		if !strings.EqualFold(hex.EncodeToString(out), tc.Output) {
+			t.Errorf("[%d] wrong scheme output %x", i, out)
+		}
+		dec, err := SuciDeconceal(tc.Scheme, hnpriv, output)
+		if err != nil {
+			t.Fatalf("[%d] deconceal failed: %+v", i, err)
+		}
+		if !bytes.Equal(dec, plain) {
+			t.Errorf("[%d] wrong scheme input %x", i, dec)
+		}
+
+		//round trip with a random ephemeral key
+		if out, err = SuciConceal(tc.Scheme, hnpub, plain); err != nil {
+			t.Fatalf("[%d] conceal failed: %+v", i, err)
+		}
+		if dec, err = SuciDeconceal(tc.Scheme, hnpriv, out); err != nil || !bytes.Equal(dec, plain) {
+			t.Errorf("[%d] round trip failed: %v", i, err)
+		}
+
+		output[len(output)-1] ^= 0x01
+		if _, err = SuciDeconceal(tc.Scheme, hnpriv, output); err == nil {
+			t.Errorf("[%d] wrong MAC must be rejected", i)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package sec5g
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// KgnbStar derives KgNB* (KNG-RAN*) for Xn/N2 handover (TS 33.501 A.11/A.12).
+// key is the current KgNB for a horizontal derivation or the fresh NH for a
+// vertical one. P0 is the target PCI on 2 octets and P1 the target ARFCN-DL
+// on 3 octets, both big-endian.
+func KgnbStar(key []byte, pci uint16, arfcndl uint32) (kgnbstar []byte, err error) {
+	if len(key) != 32 {
+		err = fmt.Errorf("Wrong KgNB/NH size")
+		return
+	}
+	if pci > 1007 {
+		err = fmt.Errorf("Invalid PCI %d", pci)
+		return
+	}
+	if arfcndl > 0xffffff {
+		err = fmt.Errorf("Invalid ARFCN-DL %d", arfcndl)
+		return
+	}
+	p0 := binary.BigEndian.AppendUint16(nil, pci)
+	p1 := []byte{uint8(arfcndl >> 16), uint8(arfcndl >> 8), uint8(arfcndl)}
+	kgnbstar, err = KDF(key, FC_FOR_KGNB_STAR_DERIVATION, p0, p1)
+	return
+}
+
+// KsnKey derives KSN, the key of a secondary node in MR-DC with 5GC, from
+// the master node key (KgNB) and the SN Counter on 2 octets (TS 33.501 A.16)
+func KsnKey(kmn []byte, sncounter uint16) (ksn []byte, err error) {
+	if len(kmn) != 32 {
+		err = fmt.Errorf("Wrong KgNB size")
+		return
+	}
+	ksn, err = KDF(kmn, FC_FOR_KSN_DERIVATION, binary.BigEndian.AppendUint16(nil, sncounter))
+	return
+}
+
+// SKgnbKey derives S-KgNB, the key of a secondary gNB in EN-DC, from KeNB and
+// the SCG Counter on 2 octets (TS 33.401 E.2.4)
+func SKgnbKey(kenb []byte, sgcounter uint16) (skgnb []byte, err error) {
+	if len(kenb) != 32 {
+		err = fmt.Errorf("Wrong KeNB size")
+		return
+	}
+	skgnb, err = KDF(kenb, FC_FOR_S_KGNB_DERIVATION, binary.BigEndian.AppendUint16(nil, sgcounter))
+	return
+}
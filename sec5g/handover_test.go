@@ -0,0 +1,52 @@
+package sec5g
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestHandoverKeys(t *testing.T) {
+	key, _ := hex.DecodeString("d5e2b6f1a3c4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e")
+
+	//70 || 01f3 || 0002 || 09a734 || 0003
+	kgnbstar, err := KgnbStar(key, 0x01f3, 632628)
+	if err != nil {
+		t.Fatalf("KgnbStar failed: %+v", err)
+	}
+	if hex.EncodeToString(kgnbstar) != "a844a5485b0a5e6a84bc08d7e97ae6e11c679a8c63660bf43efa33b6aa31900a" {
+		t.Errorf("wrong KgNB* %x", kgnbstar)
+	}
+	if _, err = KgnbStar(key, 1008, 632628); err == nil {
+		t.Errorf("invalid PCI must be rejected")
+	}
+	if _, err = KgnbStar(key, 1, 1<<24); err == nil {
+		t.Errorf("invalid ARFCN-DL must be rejected")
+	}
+	if _, err = KgnbStar(key[:16], 0x01f3, 632628); err == nil {
+		t.Errorf("short KgNB must be rejected")
+	}
+
+	//79 || 0102 || 0002
+	ksn, err := KsnKey(key, 0x0102)
+	if err != nil {
+		t.Fatalf("KsnKey failed: %+v", err)
+	}
+	if hex.EncodeToString(ksn) != "7cebd857fddc06d2b58061ace59754480a7244a7c689403c359bd663adbc8d7d" {
+		t.Errorf("wrong KSN %x", ksn)
+	}
+	if _, err = KsnKey(key[:16], 0x0102); err == nil {
+		t.Errorf("short KgNB must be rejected")
+	}
+
+	//1c || 0003 || 0002
+	skgnb, err := SKgnbKey(key, 0x0003)
+	if err != nil {
+		t.Fatalf("SKgnbKey failed: %+v", err)
+	}
+	if hex.EncodeToString(skgnb) != "ddb8330a41d8871444d997cd52cb5765b3fb495cc8dbf352b6df4818f48d2816" {
+		t.Errorf("wrong S-KgNB %x", skgnb)
+	}
+	if _, err = SKgnbKey(key[:16], 0x0003); err == nil {
+		t.Errorf("short KeNB must be rejected")
+	}
+}
@@ -0,0 +1,218 @@
+package sec5g
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// HnKey is a home network key pair for SUCI de-concealment. The private key
+// is never exposed nor printed.
+type HnKey struct {
+	Id     uint8  //Home Network Public Key Identifier
+	Scheme uint8  //protection scheme
+	Public []byte //public key (compressed for profile B)
+	priv   []byte
+}
+
+func (k HnKey) String() string {
+	return fmt.Sprintf("HnKey{Id:%d Scheme:%d Public:%x}", k.Id, k.Scheme, k.Public)
+}
+
+// Format makes all fmt verbs print the redacted form
+func (k HnKey) Format(f fmt.State, verb rune) {
+	f.Write([]byte(k.String()))
+}
+
+func (k *HnKey) wipe() {
+	for i := range k.priv {
+		k.priv[i] = 0
+	}
+}
+
+// NewHnKey builds a key pair from a raw private key
+func NewHnKey(scheme, id uint8, priv []byte) (k *HnKey, err error) {
+	k = &HnKey{
+		Id:     id,
+		Scheme: scheme,
+		priv:   append([]byte{}, priv...),
+	}
+	if k.Public, err = EciesPublicKey(scheme, k.priv); err != nil {
+		k.wipe()
+		return nil, err
+	}
+	return
+}
+
+// LoadHnKey reads a private key file: PEM (PKCS#8 or SEC1), DER or a raw key
+// in hex
+func LoadHnKey(scheme, id uint8, path string) (k *HnKey, err error) {
+	var content []byte
+	if content, err = os.ReadFile(path); err != nil {
+		return
+	}
+	defer func() {
+		for i := range content {
+			content[i] = 0
+		}
+	}()
+	var priv []byte
+	if priv, err = parseHnPrivateKey(scheme, content); err != nil {
+		return nil, fmt.Errorf("Failed to load key %d from %s: %s", id, path, err.Error())
+	}
+	k, err = NewHnKey(scheme, id, priv)
+	for i := range priv {
+		priv[i] = 0
+	}
+	return
+}
+
+func parseHnPrivateKey(scheme uint8, content []byte) ([]byte, error) {
+	der := content
+	if block, _ := pem.Decode(content); block != nil {
+		der = block.Bytes
+	} else if raw, err := hex.DecodeString(string(bytes.TrimSpace(content))); err == nil {
+		return raw, nil
+	}
+
+	var key any
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParseECPrivateKey(der); err != nil {
+			return nil, fmt.Errorf("Unknown key format")
+		}
+	}
+	if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+		if key, err = ecKey.ECDH(); err != nil {
+			return nil, err
+		}
+	}
+	ecdhKey, ok := key.(*ecdh.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported key type %T", key)
+	}
+	curve, err := eciesCurve(scheme)
+	if err != nil {
+		return nil, err
+	}
+	if ecdhKey.Curve() != curve {
+		return nil, fmt.Errorf("Key does not match protection scheme %d", scheme)
+	}
+	return ecdhKey.Bytes(), nil
+}
+
+// location of a key file for HnKeyStore.Reload
+type HnKeyFile struct {
+	Id     uint8
+	Scheme uint8
+	Path   string
+}
+
+type hnKeyIndex struct {
+	scheme uint8
+	id     uint8
+}
+
+// HnKeyStore is a key ring indexed by protection scheme and key identifier.
+// It is safe for concurrent use; keys can be added, removed or entirely
+// reloaded at runtime.
+type HnKeyStore struct {
+	keys  map[hnKeyIndex]*HnKey
+	mutex sync.RWMutex
+}
+
+func NewHnKeyStore() *HnKeyStore {
+	return &HnKeyStore{
+		keys: make(map[hnKeyIndex]*HnKey),
+	}
+}
+
+// Add inserts a key, replacing any key with the same scheme and identifier
+func (s *HnKeyStore) Add(k *HnKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx := hnKeyIndex{k.Scheme, k.Id}
+	if old, ok := s.keys[idx]; ok && old != k {
+		old.wipe()
+	}
+	s.keys[idx] = k
+}
+
+// AddFile loads a key file then inserts it
+func (s *HnKeyStore) AddFile(scheme, id uint8, path string) (err error) {
+	var k *HnKey
+	if k, err = LoadHnKey(scheme, id, path); err == nil {
+		s.Add(k)
+	}
+	return
+}
+
+// Remove deletes a key and wipes its private part
+func (s *HnKeyStore) Remove(scheme, id uint8) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx := hnKeyIndex{scheme, id}
+	if k, ok := s.keys[idx]; ok {
+		k.wipe()
+		delete(s.keys, idx)
+	}
+}
+
+// Reload replaces all keys with the ones loaded from files; the current keys
+// are kept if any file fails to load
+func (s *HnKeyStore) Reload(files []HnKeyFile) error {
+	keys := make(map[hnKeyIndex]*HnKey)
+	for _, f := range files {
+		k, err := LoadHnKey(f.Scheme, f.Id, f.Path)
+		if err != nil {
+			for _, loaded := range keys {
+				loaded.wipe()
+			}
+			return err
+		}
+		keys[hnKeyIndex{f.Scheme, f.Id}] = k
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, k := range s.keys {
+		k.wipe()
+	}
+	s.keys = keys
+	return nil
+}
+
+// Get returns a key (its public part only is accessible)
+func (s *HnKeyStore) Get(scheme, id uint8) (k *HnKey, ok bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	k, ok = s.keys[hnKeyIndex{scheme, id}]
+	return
+}
+
+// Keys lists the stored keys
+func (s *HnKeyStore) Keys() (keys []*HnKey) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	return
+}
+
+// Deconceal de-conceals a SUCI scheme output with the key of the given
+// scheme and identifier
+func (s *HnKeyStore) Deconceal(scheme, id uint8, output []byte) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	k, ok := s.keys[hnKeyIndex{scheme, id}]
+	if !ok {
+		return nil, fmt.Errorf("No home network key %d for protection scheme %d", id, scheme)
+	}
+	return SuciDeconceal(scheme, k.priv, output)
+}
@@ -0,0 +1,81 @@
+package sec5g
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHnKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	plain, _ := hex.DecodeString("00012080f6")
+
+	keyA, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	keyB, _ := ecdh.P256().GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(keyA)
+	pemA := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	derB, _ := x509.MarshalPKCS8PrivateKey(keyB)
+
+	files := []HnKeyFile{
+		{Id: 1, Scheme: SUCI_SCHEME_PROFILE_A, Path: filepath.Join(dir, "a.pem")},
+		{Id: 2, Scheme: SUCI_SCHEME_PROFILE_A, Path: filepath.Join(dir, "a.hex")},
+		{Id: 1, Scheme: SUCI_SCHEME_PROFILE_B, Path: filepath.Join(dir, "b.der")},
+	}
+	os.WriteFile(files[0].Path, pemA, 0600)
+	os.WriteFile(files[1].Path, []byte(hex.EncodeToString(keyA.Bytes())+"\n"), 0600)
+	os.WriteFile(files[2].Path, derB, 0600)
+
+	store := NewHnKeyStore()
+	if err := store.Reload(files); err != nil {
+		t.Fatalf("Reload failed: %+v", err)
+	}
+	for _, f := range files {
+		k, ok := store.Get(f.Scheme, f.Id)
+		if !ok {
+			t.Fatalf("missing key %d/%d", f.Scheme, f.Id)
+		}
+		out, _ := SuciConceal(f.Scheme, k.Public, plain)
+		if dec, err := store.Deconceal(f.Scheme, f.Id, out); err != nil || !bytes.Equal(dec, plain) {
+			t.Errorf("deconceal with key %d/%d failed: %v", f.Scheme, f.Id, err)
+		}
+		//key material must not leak through fmt
+		secret := hex.EncodeToString(k.priv)
+		for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x"} {
+			if s := fmt.Sprintf(format, k); strings.Contains(s, secret) || strings.Contains(s, fmt.Sprint(k.priv)) {
+				t.Errorf("private key printed with %s", format)
+			}
+		}
+		if s := fmt.Sprintf("%v", *k); strings.Contains(s, secret) {
+			t.Errorf("private key printed")
+		}
+	}
+
+	//rotation
+	k, _ := store.Get(SUCI_SCHEME_PROFILE_A, 1)
+	store.Remove(SUCI_SCHEME_PROFILE_A, 1)
+	if _, ok := store.Get(SUCI_SCHEME_PROFILE_A, 1); ok {
+		t.Errorf("removed key is still there")
+	}
+	if !bytes.Equal(k.priv, make([]byte, 32)) {
+		t.Errorf("removed key is not wiped")
+	}
+	if err := store.AddFile(SUCI_SCHEME_PROFILE_A, 3, files[0].Path); err != nil {
+		t.Errorf("AddFile failed: %+v", err)
+	}
+
+	//a failed reload keeps the current keys
+	if err := store.Reload([]HnKeyFile{{Id: 4, Scheme: SUCI_SCHEME_PROFILE_B, Path: files[0].Path}}); err == nil {
+		t.Errorf("key of another curve must be rejected")
+	}
+	if len(store.Keys()) != 3 {
+		t.Errorf("keys must be kept after a failed reload")
+	}
+}
@@ -0,0 +1,334 @@
+package sec5g
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SUPI and SUCI (TS 23.003 2.2A/2.2B, TS 29.503 string form, TS 24.501
+// 9.11.3.4 5GS mobile identity)
+
+const (
+	SUPI_TYPE_IMSI uint8 = 0
+	SUPI_TYPE_NAI  uint8 = 1
+
+	MOBILE_IDENTITY_SUCI uint8 = 1 //type of identity
+)
+
+type Supi struct {
+	Type  uint8
+	Value string //IMSI digits or NAI
+}
+
+func ParseSupi(s string) (supi *Supi, err error) {
+	switch {
+	case strings.HasPrefix(s, "imsi-"):
+		supi = &Supi{Type: SUPI_TYPE_IMSI, Value: s[5:]}
+		if l := len(supi.Value); l < 5 || l > 15 || !isDigits(supi.Value) {
+			return nil, fmt.Errorf("Invalid IMSI %s", supi.Value)
+		}
+	case strings.HasPrefix(s, "nai-"):
+		supi = &Supi{Type: SUPI_TYPE_NAI, Value: s[4:]}
+		if len(supi.Value) == 0 {
+			return nil, fmt.Errorf("Empty NAI")
+		}
+	default:
+		err = fmt.Errorf("Unknown SUPI format %s", s)
+	}
+	return
+}
+
+func (s *Supi) String() string {
+	if s.Type == SUPI_TYPE_NAI {
+		return "nai-" + s.Value
+	}
+	return "imsi-" + s.Value
+}
+
+type Suci struct {
+	SupiType         uint8
+	Mcc              string //IMSI based SUCI
+	Mnc              string //IMSI based SUCI
+	HomeNetwork      string //home network identifier of a NAI based SUCI
+	RoutingIndicator string
+	Scheme           uint8
+	KeyId            uint8
+	SchemeOutput     []byte //BCD encoded MSIN for the null-scheme
+}
+
+// ParseSuci parses "suci-<supi type>-<mcc>-<mnc>-<routing indicator>-
+// <scheme>-<key id>-<scheme output>" (IMSI) or "suci-<supi type>-<home
+// network identifier>-<routing indicator>-<scheme>-<key id>-<scheme output>"
+func ParseSuci(s string) (suci *Suci, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 2 || parts[0] != "suci" {
+		return nil, fmt.Errorf("Unknown SUCI format %s", s)
+	}
+	suci = &Suci{}
+	var tail []string
+	switch parts[1] {
+	case "0":
+		if len(parts) != 8 {
+			return nil, fmt.Errorf("Wrong number of SUCI fields")
+		}
+		suci.SupiType = SUPI_TYPE_IMSI
+		suci.Mcc, suci.Mnc = parts[2], parts[3]
+		if len(suci.Mcc) != 3 || !isDigits(suci.Mcc) || len(suci.Mnc) < 2 || len(suci.Mnc) > 3 || !isDigits(suci.Mnc) {
+			return nil, fmt.Errorf("Invalid PLMN %s-%s", suci.Mcc, suci.Mnc)
+		}
+		tail = parts[4:]
+	case "1":
+		//the home network identifier may contain dashes
+		if len(parts) < 7 {
+			return nil, fmt.Errorf("Wrong number of SUCI fields")
+		}
+		suci.SupiType = SUPI_TYPE_NAI
+		suci.HomeNetwork = strings.Join(parts[2:len(parts)-4], "-")
+		tail = parts[len(parts)-4:]
+	default:
+		return nil, fmt.Errorf("Unsupported SUPI type %s", parts[1])
+	}
+
+	suci.RoutingIndicator = tail[0]
+	if l := len(suci.RoutingIndicator); l < 1 || l > 4 || !isDigits(suci.RoutingIndicator) {
+		return nil, fmt.Errorf("Invalid routing indicator %s", suci.RoutingIndicator)
+	}
+	var v uint64
+	if v, err = strconv.ParseUint(tail[1], 16, 4); err != nil {
+		return nil, fmt.Errorf("Invalid protection scheme %s", tail[1])
+	}
+	suci.Scheme = uint8(v)
+	if v, err = strconv.ParseUint(tail[2], 10, 8); err != nil {
+		return nil, fmt.Errorf("Invalid home network public key identifier %s", tail[2])
+	}
+	suci.KeyId = uint8(v)
+
+	if suci.Scheme == SUCI_SCHEME_NULL {
+		if suci.SupiType == SUPI_TYPE_IMSI && !isDigits(tail[3]) {
+			return nil, fmt.Errorf("Invalid MSIN %s", tail[3])
+		}
+		if suci.SupiType == SUPI_TYPE_IMSI {
+			suci.SchemeOutput = EncodeBcd(tail[3])
+		} else {
+			suci.SchemeOutput = []byte(tail[3])
+		}
+	} else if suci.SchemeOutput, err = hex.DecodeString(tail[3]); err != nil {
+		return nil, fmt.Errorf("Invalid scheme output: %s", err.Error())
+	}
+	return
+}
+
+func (s *Suci) String() string {
+	var output string
+	if s.Scheme != SUCI_SCHEME_NULL {
+		output = hex.EncodeToString(s.SchemeOutput)
+	} else if s.SupiType == SUPI_TYPE_IMSI {
+		output = DecodeBcd(s.SchemeOutput)
+	} else {
+		output = string(s.SchemeOutput)
+	}
+	network := s.Mcc + "-" + s.Mnc
+	if s.SupiType == SUPI_TYPE_NAI {
+		network = s.HomeNetwork
+	}
+	return fmt.Sprintf("suci-%d-%s-%s-%x-%d-%s", s.SupiType, network, s.RoutingIndicator, s.Scheme, s.KeyId, output)
+}
+
+// MarshalBinary encodes the value part of the 5GS mobile identity IE (from
+// the octet with the type of identity); only IMSI based SUCIs are supported
+func (s *Suci) MarshalBinary() ([]byte, error) {
+	if s.SupiType != SUPI_TYPE_IMSI {
+		return nil, fmt.Errorf("Binary encoding of NAI based SUCI is not supported")
+	}
+	plmn, err := EncodePlmn(s.Mcc, s.Mnc)
+	if err != nil {
+		return nil, err
+	}
+	ri := s.RoutingIndicator
+	if l := len(ri); l < 1 || l > 4 || !isDigits(ri) {
+		return nil, fmt.Errorf("Invalid routing indicator %s", ri)
+	}
+	buf := make([]byte, 0, 8+len(s.SchemeOutput))
+	buf = append(buf, s.SupiType<<4|MOBILE_IDENTITY_SUCI)
+	buf = append(buf, plmn[:]...)
+	buf = append(buf, EncodeBcd(ri+strings.Repeat("f", 4-len(ri)))...)
+	buf = append(buf, s.Scheme&0x0f, s.KeyId)
+	buf = append(buf, s.SchemeOutput...)
+	return buf, nil
+}
+
+func (s *Suci) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 8 {
+		return fmt.Errorf("SUCI is too short")
+	}
+	if buf[0]&0x07 != MOBILE_IDENTITY_SUCI {
+		return fmt.Errorf("Not a SUCI: type of identity %d", buf[0]&0x07)
+	}
+	if supitype := (buf[0] >> 4) & 0x07; supitype != SUPI_TYPE_IMSI {
+		return fmt.Errorf("Unsupported SUPI format %d", supitype)
+	}
+	var plmn [3]byte
+	copy(plmn[:], buf[1:4])
+	mcc, mnc, err := DecodePlmn(plmn)
+	if err != nil {
+		return err
+	}
+	ri := DecodeBcd(buf[4:6])
+	if len(ri) == 0 || !isDigits(ri) {
+		return fmt.Errorf("Invalid routing indicator %x", buf[4:6])
+	}
+	*s = Suci{
+		SupiType:         SUPI_TYPE_IMSI,
+		Mcc:              mcc,
+		Mnc:              mnc,
+		RoutingIndicator: ri,
+		Scheme:           buf[6] & 0x0f,
+		KeyId:            buf[7],
+		SchemeOutput:     append([]byte{}, buf[8:]...),
+	}
+	return nil
+}
+
+// Supi de-conceals the SUCI with the home network keys (which can be nil for
+// the null-scheme)
+func (s *Suci) Supi(keys *HnKeyStore) (supi *Supi, err error) {
+	input := s.SchemeOutput
+	if s.Scheme != SUCI_SCHEME_NULL {
+		if keys == nil {
+			return nil, fmt.Errorf("No home network key store")
+		}
+		if input, err = keys.Deconceal(s.Scheme, s.KeyId, s.SchemeOutput); err != nil {
+			return
+		}
+	}
+	if s.SupiType == SUPI_TYPE_NAI {
+		//the scheme input is the username of the NAI
+		return &Supi{Type: SUPI_TYPE_NAI, Value: string(input) + "@" + s.HomeNetwork}, nil
+	}
+	msin := DecodeBcd(input)
+	if !isDigits(msin) {
+		return nil, fmt.Errorf("Invalid MSIN %x", input)
+	}
+	supi = &Supi{
+		Type:  SUPI_TYPE_IMSI,
+		Value: s.Mcc + s.Mnc + msin,
+	}
+	return
+}
+
+// Suci conceals an IMSI based SUPI; mnclen tells the number of MNC digits.
+// hnpub is ignored for the null-scheme.
+func (s *Supi) Suci(mnclen int, routing string, scheme, keyid uint8, hnpub []byte) (suci *Suci, err error) {
+	if s.Type != SUPI_TYPE_IMSI {
+		return nil, fmt.Errorf("Only IMSI based SUPI can be concealed")
+	}
+	if (mnclen != 2 && mnclen != 3) || len(s.Value) <= 3+mnclen {
+		return nil, fmt.Errorf("Invalid MNC length %d", mnclen)
+	}
+	if len(routing) == 0 {
+		routing = "0"
+	}
+	suci = &Suci{
+		SupiType:         SUPI_TYPE_IMSI,
+		Mcc:              s.Value[:3],
+		Mnc:              s.Value[3 : 3+mnclen],
+		RoutingIndicator: routing,
+		Scheme:           scheme,
+		KeyId:            keyid,
+		SchemeOutput:     EncodeBcd(s.Value[3+mnclen:]),
+	}
+	if scheme == SUCI_SCHEME_NULL {
+		suci.KeyId = 0
+	} else if suci.SchemeOutput, err = SuciConceal(scheme, hnpub, suci.SchemeOutput); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// EncodePlmn encodes MCC/MNC as in TS 24.008 10.5.1.13 (MNC digit 3 is F
+// for 2-digit MNCs)
+func EncodePlmn(mcc, mnc string) (plmn [3]byte, err error) {
+	if len(mcc) != 3 || !isDigits(mcc) || len(mnc) < 2 || len(mnc) > 3 || !isDigits(mnc) {
+		err = fmt.Errorf("Invalid PLMN %s-%s", mcc, mnc)
+		return
+	}
+	d := []byte(mcc + mnc + "f")
+	for i := range d {
+		d[i] = hexNibble(d[i])
+	}
+	plmn[0] = d[1]<<4 | d[0]
+	plmn[1] = d[5]<<4 | d[2]
+	plmn[2] = d[4]<<4 | d[3]
+	return
+}
+
+func DecodePlmn(plmn [3]byte) (mcc, mnc string, err error) {
+	digits := []byte{plmn[0] & 0x0f, plmn[0] >> 4, plmn[1] & 0x0f, plmn[2] & 0x0f, plmn[2] >> 4, plmn[1] >> 4}
+	var s []byte
+	for i, d := range digits {
+		if d == 0x0f && i == 5 {
+			break
+		}
+		if d > 9 {
+			err = fmt.Errorf("Invalid PLMN %x", plmn)
+			return
+		}
+		s = append(s, '0'+d)
+	}
+	mcc, mnc = string(s[:3]), string(s[3:])
+	return
+}
+
+// EncodeBcd packs digits in semi-octets, first digit in the low nibble and
+// an odd number of digits padded with F
+func EncodeBcd(digits string) []byte {
+	buf := make([]byte, (len(digits)+1)/2)
+	for i := range buf {
+		buf[i] = 0xf0
+	}
+	for i := 0; i < len(digits); i++ {
+		if i%2 == 0 {
+			buf[i/2] = buf[i/2]&0xf0 | hexNibble(digits[i])
+		} else {
+			buf[i/2] = buf[i/2]&0x0f | hexNibble(digits[i])<<4
+		}
+	}
+	return buf
+}
+
+// DecodeBcd unpacks semi-octets until the first F filler
+func DecodeBcd(buf []byte) string {
+	s := make([]byte, 0, 2*len(buf))
+	for _, b := range buf {
+		for _, d := range []byte{b & 0x0f, b >> 4} {
+			if d == 0x0f {
+				return string(s)
+			}
+			s = append(s, "0123456789abcde"[d])
+		}
+	}
+	return string(s)
+}
+
+func hexNibble(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0x0f
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
@@ -0,0 +1,99 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSupi(t *testing.T) {
+	for _, s := range []string{"imsi-001010000000001", "nai-user@example.com"} {
+		supi, err := ParseSupi(s)
+		if err != nil {
+			t.Fatalf("ParseSupi(%s) failed: %+v", s, err)
+		}
+		if supi.String() != s {
+			t.Errorf("wrong SUPI string %s", supi.String())
+		}
+	}
+	for _, s := range []string{"imsi-0010", "imsi-00101000000000a", "nai-", "gci-xxx"} {
+		if _, err := ParseSupi(s); err == nil {
+			t.Errorf("invalid SUPI %s must be rejected", s)
+		}
+	}
+}
+
+func TestSuci(t *testing.T) {
+	s := "suci-0-001-01-0000-0-0-0000000001"
+	suci, err := ParseSuci(s)
+	if err != nil {
+		t.Fatalf("ParseSuci failed: %+v", err)
+	}
+	if suci.String() != s {
+		t.Errorf("wrong SUCI string %s", suci.String())
+	}
+	buf, err := suci.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %+v", err)
+	}
+	if hex.EncodeToString(buf) != "0100f110000000000000000010" {
+		t.Errorf("wrong binary SUCI %x", buf)
+	}
+	var decoded Suci
+	if err = decoded.UnmarshalBinary(buf); err != nil || decoded.String() != s {
+		t.Errorf("wrong decoded SUCI %s: %v", decoded.String(), err)
+	}
+	supi, err := suci.Supi(nil)
+	if err != nil || supi.String() != "imsi-001010000000001" {
+		t.Errorf("wrong null-scheme SUPI %v: %v", supi, err)
+	}
+
+	//routing indicator with less than 4 digits
+	buf, _ = (&Suci{SupiType: SUPI_TYPE_IMSI, Mcc: "208", Mnc: "93", RoutingIndicator: "0", SchemeOutput: EncodeBcd("0000001")}).MarshalBinary()
+	if hex.EncodeToString(buf) != "0102f839f0ff0000000000f1" {
+		t.Errorf("wrong binary SUCI %x", buf)
+	}
+
+	nai := "suci-1-home-net.example.com-12-1-7-abcd"
+	if suci, err = ParseSuci(nai); err != nil {
+		t.Fatalf("ParseSuci failed: %+v", err)
+	}
+	if suci.HomeNetwork != "home-net.example.com" || suci.RoutingIndicator != "12" || suci.KeyId != 7 || suci.String() != nai {
+		t.Errorf("wrong NAI based SUCI %+v", suci)
+	}
+	for _, s := range []string{"suci-0-001-01-0000-0-0", "suci-0-01-01-0000-0-0-1", "suci-0-001-01-00000-0-0-1", "suci-0-001-01-0-1-256-aa", "suci-0-001-01-0-1-1-xx"} {
+		if _, err = ParseSuci(s); err == nil {
+			t.Errorf("invalid SUCI %s must be rejected", s)
+		}
+	}
+}
+
+func TestSuciConcealment(t *testing.T) {
+	hnpriv, _ := hex.DecodeString("c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d")
+	key, _ := NewHnKey(SUCI_SCHEME_PROFILE_A, 3, hnpriv)
+	store := NewHnKeyStore()
+	store.Add(key)
+
+	supi, _ := ParseSupi("imsi-208930000000001")
+	suci, err := supi.Suci(2, "1234", SUCI_SCHEME_PROFILE_A, 3, key.Public)
+	if err != nil {
+		t.Fatalf("conceal failed: %+v", err)
+	}
+	//through the string and binary forms
+	parsed, err := ParseSuci(suci.String())
+	if err != nil {
+		t.Fatalf("ParseSuci failed: %+v", err)
+	}
+	buf, _ := parsed.MarshalBinary()
+	var decoded Suci
+	if err = decoded.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %+v", err)
+	}
+	if !bytes.Equal(decoded.SchemeOutput, suci.SchemeOutput) || decoded.RoutingIndicator != "1234" {
+		t.Errorf("wrong decoded SUCI %s", decoded.String())
+	}
+	recovered, err := decoded.Supi(store)
+	if err != nil || recovered.String() != supi.String() {
+		t.Errorf("wrong de-concealed SUPI %v: %v", recovered, err)
+	}
+}
@@ -0,0 +1,71 @@
+package sec5g
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 5GS-EPS interworking key mapping (TS 33.501 A.14/A.15, TS 33.401 A.2)
+
+// KASME derives the EPS KASME from CK||IK, the serving network id (3 octets
+// PLMN identity) and SQN xor AK
+func KASME(ckik, snid, sqnxorak []byte) (kasme []byte, err error) {
+	if len(ckik) != 32 {
+		err = fmt.Errorf("Wrong CK||IK size")
+		return
+	}
+	if len(snid) != 3 || len(sqnxorak) != 6 {
+		err = fmt.Errorf("Wrong SN id or SQN xor AK size")
+		return
+	}
+	kasme, err = KDF(ckik, FC_FOR_KASME_DERIVATION, snid, sqnxorak)
+	return
+}
+
+// KasmePrimeIdle maps KAMF to KASME' for 5GS to EPS idle mode mobility with
+// the uplink NAS COUNT of the TAU Request
+func KasmePrimeIdle(kamf []byte, ulcount uint32) (kasme []byte, err error) {
+	if len(kamf) != 32 {
+		err = fmt.Errorf("Wrong KAMF size")
+		return
+	}
+	kasme, err = KDF(kamf, FC_FOR_KASME_PRIME_IDLE_DERIVATION, binary.BigEndian.AppendUint32(nil, ulcount))
+	return
+}
+
+// KasmePrimeHandover maps KAMF to KASME' for 5GS to EPS handover with the
+// downlink NAS COUNT
+func KasmePrimeHandover(kamf []byte, dlcount uint32) (kasme []byte, err error) {
+	if len(kamf) != 32 {
+		err = fmt.Errorf("Wrong KAMF size")
+		return
+	}
+	kasme, err = KDF(kamf, FC_FOR_KASME_PRIME_HO_DERIVATION, binary.BigEndian.AppendUint32(nil, dlcount))
+	return
+}
+
+// KamfFromKasmeIdle maps KASME to KAMF' for EPS to 5GS idle mode mobility
+// with the uplink NAS COUNT of the Registration Request
+func KamfFromKasmeIdle(kasme []byte, ulcount uint32) (kamf []byte, err error) {
+	if len(kasme) != 32 {
+		err = fmt.Errorf("Wrong KASME size")
+		return
+	}
+	kamf, err = KDF(kasme, FC_FOR_KAMF_FROM_KASME_IDLE, binary.BigEndian.AppendUint32(nil, ulcount))
+	return
+}
+
+// KamfFromKasmeHandover maps KASME to KAMF' for EPS to 5GS handover with the
+// NH value sent to the target
+func KamfFromKasmeHandover(kasme, nh []byte) (kamf []byte, err error) {
+	if len(kasme) != 32 {
+		err = fmt.Errorf("Wrong KASME size")
+		return
+	}
+	if len(nh) != 32 {
+		err = fmt.Errorf("Wrong NH size")
+		return
+	}
+	kamf, err = KDF(kasme, FC_FOR_KAMF_FROM_KASME_HO, nh)
+	return
+}
@@ -0,0 +1,61 @@
+package sec5g
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestInterworkingKeys(t *testing.T) {
+	key, _ := hex.DecodeString("0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0")
+
+	//10 || 02f839 || 0003 || ff9bb4d0b607 || 0006
+	kasme, err := KASME(key, []byte{0x02, 0xf8, 0x39}, []byte{0xff, 0x9b, 0xb4, 0xd0, 0xb6, 0x07})
+	if err != nil {
+		t.Fatalf("KASME failed: %+v", err)
+	}
+	if hex.EncodeToString(kasme) != "9b1c6107bce5cca34c28f43d97e4f829a422a28bbba0a422463eab110c9af7f6" {
+		t.Errorf("wrong KASME %x", kasme)
+	}
+	if _, err = KASME(key, []byte{0x02, 0xf8}, make([]byte, 6)); err == nil {
+		t.Errorf("short SN id must be rejected")
+	}
+	if _, err = KASME(key[:16], []byte{0x02, 0xf8, 0x39}, make([]byte, 6)); err == nil {
+		t.Errorf("short CK||IK must be rejected")
+	}
+
+	cases := []struct {
+		fn     func([]byte, uint32) ([]byte, error)
+		expect string
+	}{
+		//73 || 00010203 || 0004
+		{KasmePrimeIdle, "ab2d5ca00de4dec37363c3cf6a23ec7f5f444bd0e32701b56f01a79e873e28bb"},
+		//74 || 00010203 || 0004
+		{KasmePrimeHandover, "424fc3d5a83b2827cec91ef14f7fd60edd6e2b6cfb3b46f3d16e6c106c84ea05"},
+		//75 || 00010203 || 0004
+		{KamfFromKasmeIdle, "9eeaa35bb8050c8620e48cb5c329c5d8a787e992d78dcae6c6b7daa1cb99eabd"},
+	}
+	for i, c := range cases {
+		out, _ := c.fn(key, 0x00010203)
+		if hex.EncodeToString(out) != c.expect {
+			t.Errorf("case %d: wrong key %x", i, out)
+		}
+		if _, err = c.fn(key[:16], 0x00010203); err == nil {
+			t.Errorf("case %d: short key must be rejected", i)
+		}
+	}
+
+	//76 || NH || 0020
+	kamf, err := KamfFromKasmeHandover(key, key)
+	if err != nil {
+		t.Fatalf("KamfFromKasmeHandover failed: %+v", err)
+	}
+	if hex.EncodeToString(kamf) != "be73b846cc08abf2b21cb5756d96055ef385178a6bb6604807db0837a83fc591" {
+		t.Errorf("wrong KAMF %x", kamf)
+	}
+	if _, err = KamfFromKasmeHandover(key, key[:16]); err == nil {
+		t.Errorf("short NH must be rejected")
+	}
+	if _, err = KamfFromKasmeHandover(key[:16], key); err == nil {
+		t.Errorf("short KASME must be rejected")
+	}
+}
@@ -0,0 +1,159 @@
+package sec5g
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// the KDF built with crypto/hmac and a fresh S buffer, as reference
+func kdfReference(key []byte, fc uint8, param ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	s := []byte{fc}
+	for _, p := range param {
+		s = binary.BigEndian.AppendUint16(append(s, p...), uint16(len(p)))
+	}
+	mac.Write(s)
+	return mac.Sum(nil)
+}
+
+// The specifications publish no test data for the derivations built on KDF
+// (handover, interworking, AKMA, SoR/UPU and algorithm keys), so their tests
+// pin values computed offline with Python's hmac module over the S strings
+// written next to each value.
+
+func TestKdfEngine(t *testing.T) {
+	e := NewKdfEngine()
+	params := [][]byte{[]byte("5G:mnc093.mcc208.3gppnetwork.org"), {0xbb, 0x52, 0xe9, 0x1c, 0x74, 0x7a}, {}}
+	for _, size := range []int{0, 16, 32, 64, 65, 100} {
+		key := bytes.Repeat([]byte{uint8(size)}, size)
+		for n := 0; n <= len(params); n++ {
+			expected := kdfReference(key, FC_KAUSF, params[:n]...)
+			if sum := e.Derive(nil, key, FC_KAUSF, params[:n]...); !bytes.Equal(sum, expected) {
+				t.Errorf("key size %d, %d params: wrong output %x", size, n, sum)
+			}
+			if sum := KDFWithFC(key, FC_KAUSF, params[:n]...); !bytes.Equal(sum, expected) {
+				t.Errorf("key size %d, %d params: wrong pooled output %x", size, n, sum)
+			}
+		}
+	}
+
+	//Derive appends to dst
+	prefix := []byte{1, 2}
+	sum := e.Derive(prefix, params[0], FC_NH, params[1])
+	if !bytes.Equal(sum[:2], prefix) || !bytes.Equal(sum[2:], kdfReference(params[0], FC_NH, params[1])) {
+		t.Errorf("wrong appended output %x", sum)
+	}
+
+	//a longer FC is the raw prefix of S, as KDF always accepted
+	mac := hmac.New(sha256.New, params[0])
+	mac.Write([]byte{0x6a, 0x6b, 0xbb, 0x52, 0xe9, 0x1c, 0x74, 0x7a, 0x00, 0x06})
+	if sum, err := KDF(params[0], "6a6b", params[1]); err != nil || !bytes.Equal(sum, mac.Sum(nil)) {
+		t.Errorf("two bytes FC: wrong output %x (%v)", sum, err)
+	}
+	if _, err := KDF(params[0], "zz", params[1]); err == nil {
+		t.Errorf("non hex FC must be rejected")
+	}
+
+	//the string codes decode to the byte codes
+	codes := map[string]uint8{
+		FC_FOR_CK_PRIME_IK_PRIME_DERIVATION:  FC_CK_PRIME_IK_PRIME,
+		FC_FOR_KASME_DERIVATION:              FC_KASME,
+		FC_FOR_S_KGNB_DERIVATION:             FC_S_KGNB,
+		FC_FOR_ALGORITHM_KEY_DERIVATION:      FC_ALGORITHM_KEY,
+		FC_FOR_KAUSF_DERIVATION:              FC_KAUSF,
+		FC_FOR_RES_STAR_XRES_STAR_DERIVATION: FC_RES_STAR_XRES_STAR,
+		FC_FOR_KSEAF_DERIVATION:              FC_KSEAF,
+		FC_FOR_KAMF_DERIVATION:               FC_KAMF,
+		FC_FOR_KGNB_KN3IWF_DERIVATION:        FC_KGNB_KN3IWF,
+		FC_FOR_NH_DERIVATION:                 FC_NH,
+		FC_FOR_KGNB_STAR_DERIVATION:          FC_KGNB_STAR,
+		FC_FOR_KAMF_PRIME_DERIVATION:         FC_KAMF_PRIME,
+		FC_FOR_KASME_PRIME_IDLE_DERIVATION:   FC_KASME_PRIME_IDLE,
+		FC_FOR_KASME_PRIME_HO_DERIVATION:     FC_KASME_PRIME_HO,
+		FC_FOR_KAMF_FROM_KASME_IDLE:          FC_KAMF_FROM_KASME_IDLE,
+		FC_FOR_KAMF_FROM_KASME_HO:            FC_KAMF_FROM_KASME_HO,
+		FC_FOR_SOR_MAC_IAUSF:                 FC_SOR_MAC_IAUSF,
+		FC_FOR_SOR_MAC_IUE:                   FC_SOR_MAC_IUE,
+		FC_FOR_KSN_DERIVATION:                FC_KSN,
+		FC_FOR_UPU_MAC_IAUSF:                 FC_UPU_MAC_IAUSF,
+		FC_FOR_UPU_MAC_IUE:                   FC_UPU_MAC_IUE,
+		FC_FOR_KAKMA_DERIVATION:              FC_KAKMA,
+		FC_FOR_A_TID_DERIVATION:              FC_A_TID,
+		FC_FOR_KAF_DERIVATION:                FC_KAF,
+	}
+	for s, b := range codes {
+		if decoded, _ := hex.DecodeString(s); len(decoded) != 1 || decoded[0] != b {
+			t.Errorf("FC %s differs from %#x", s, b)
+		}
+	}
+}
+
+func TestKdfEngineAllocations(t *testing.T) {
+	e := NewKdfEngine()
+	key := bytes.Repeat([]byte{0x5a}, 32)
+	snn := []byte("5G:mnc093.mcc208.3gppnetwork.org")
+	sqnxorak := []byte{0xbb, 0x52, 0xe9, 0x1c, 0x74, 0x7a}
+	dst := make([]byte, 0, 32)
+	allocs := testing.AllocsPerRun(100, func() {
+		e.Derive(dst[:0], key, FC_KAUSF, snn, sqnxorak)
+	})
+	if allocs != 0 {
+		t.Errorf("Derive allocates %.1f times", allocs)
+	}
+}
+
+func benchmarkKdfInput() (key, snn, sqnxorak []byte) {
+	return bytes.Repeat([]byte{0x5a}, 32), []byte("5G:mnc093.mcc208.3gppnetwork.org"), []byte{0xbb, 0x52, 0xe9, 0x1c, 0x74, 0x7a}
+}
+
+func reportDerivationRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "derivations/s")
+}
+
+// hmac.New and a new S buffer per derivation, as KDF used to do
+func BenchmarkKdfReference(b *testing.B) {
+	key, snn, sqnxorak := benchmarkKdfInput()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		kdfReference(key, FC_KAUSF, snn, sqnxorak)
+	}
+	reportDerivationRate(b)
+}
+
+func BenchmarkKDF(b *testing.B) {
+	key, snn, sqnxorak := benchmarkKdfInput()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		KDF(key, FC_FOR_KAUSF_DERIVATION, snn, sqnxorak)
+	}
+	reportDerivationRate(b)
+}
+
+func BenchmarkKdfEngine(b *testing.B) {
+	key, snn, sqnxorak := benchmarkKdfInput()
+	e := NewKdfEngine()
+	dst := make([]byte, 0, 32)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dst = e.Derive(dst[:0], key, FC_KAUSF, snn, sqnxorak)
+	}
+	reportDerivationRate(b)
+}
+
+// one engine per goroutine, as on a registration hot path
+func BenchmarkKdfEngineParallel(b *testing.B) {
+	key, snn, sqnxorak := benchmarkKdfInput()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		e := NewKdfEngine()
+		dst := make([]byte, 0, 32)
+		for pb.Next() {
+			dst = e.Derive(dst[:0], key, FC_KAUSF, snn, sqnxorak)
+		}
+	})
+	reportDerivationRate(b)
+}
@@ -0,0 +1,153 @@
+package sec5g
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// access type distinguishers of the KgNB/KN3IWF derivation (TS 33.501 A.9)
+const (
+	ACCESS_TYPE_3GPP     uint8 = 0x01
+	ACCESS_TYPE_NON_3GPP uint8 = 0x02
+)
+
+// KAMF' derivation directions (TS 33.501 A.13)
+const (
+	KAMF_PRIME_IDLE     uint8 = 0x00 //uplink NAS COUNT of the Registration Request
+	KAMF_PRIME_HANDOVER uint8 = 0x01 //downlink NAS COUNT
+)
+
+// snapshot of a KeyHierarchy
+type KeyHierarchyState struct {
+	Kamf    []byte
+	Kgnb    []byte //KgNB or KN3IWF
+	Nh      []byte //last NH of the chain, nil before the first one
+	Ncc     uint8
+	UlCount uint32 //uplink NAS COUNT used for KgNB
+	Access  uint8  //access type distinguisher used for KgNB
+}
+
+// KeyHierarchy keeps the keys below KSEAF: KAMF, KgNB/KN3IWF and the NH
+// chain with its NCC (TS 33.501 6.2 and 6.9.2.1.1)
+type KeyHierarchy struct {
+	state KeyHierarchyState
+	mutex sync.Mutex
+}
+
+// NewKeyHierarchy derives KAMF from KSEAF, the SUPI and ABBA
+func NewKeyHierarchy(kseaf, supi, abba []byte) (h *KeyHierarchy, err error) {
+	var kamf []byte
+	if kamf, err = KAMF(kseaf, supi, abba); err != nil {
+		return
+	}
+	h = &KeyHierarchy{}
+	h.state.Kamf = kamf
+	return
+}
+
+// RestoreKeyHierarchy builds a hierarchy from an exported state
+func RestoreKeyHierarchy(state KeyHierarchyState) (h *KeyHierarchy, err error) {
+	if len(state.Kamf) != 32 || (state.Kgnb != nil && len(state.Kgnb) != 32) || (state.Nh != nil && len(state.Nh) != 32) {
+		err = fmt.Errorf("Wrong key size")
+		return
+	}
+	h = &KeyHierarchy{}
+	h.state = copyKeyState(state)
+	h.state.Ncc &= 0x07
+	return
+}
+
+func copyKeyState(s KeyHierarchyState) KeyHierarchyState {
+	clone := func(b []byte) []byte {
+		if b == nil {
+			return nil
+		}
+		return append([]byte{}, b...)
+	}
+	s.Kamf = clone(s.Kamf)
+	s.Kgnb = clone(s.Kgnb)
+	s.Nh = clone(s.Nh)
+	return s
+}
+
+// State exports a copy of the current keys and counters
+func (h *KeyHierarchy) State() KeyHierarchyState {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return copyKeyState(h.state)
+}
+
+func (h *KeyHierarchy) Kamf() []byte {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]byte{}, h.state.Kamf...)
+}
+
+// DeriveKgnb derives the KgNB (or KN3IWF for the non-3GPP access) of an
+// initial AS security context with the given uplink NAS COUNT. The NH chain
+// restarts with NCC = 0.
+func (h *KeyHierarchy) DeriveKgnb(ulcount uint32, access uint8) (kgnb []byte, err error) {
+	if access != ACCESS_TYPE_3GPP && access != ACCESS_TYPE_NON_3GPP {
+		err = fmt.Errorf("Unknown access type %d", access)
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	count := binary.BigEndian.AppendUint32(nil, ulcount)
+	if kgnb, err = RanKey(h.state.Kamf, count, []byte{access}); err != nil {
+		return
+	}
+	h.state.Kgnb = kgnb
+	h.state.Nh = nil
+	h.state.Ncc = 0
+	h.state.UlCount = ulcount
+	h.state.Access = access
+	return append([]byte{}, kgnb...), nil
+}
+
+// NextNh derives the next NH of the chain (from KgNB for the first one) and
+// increments NCC
+func (h *KeyHierarchy) NextNh() (nh []byte, ncc uint8, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	input := h.state.Nh //SYNC-input
+	if input == nil {
+		if input = h.state.Kgnb; input == nil {
+			err = fmt.Errorf("KgNB has not been derived")
+			return
+		}
+	}
+	if nh, err = NhKey(h.state.Kamf, input); err != nil {
+		return
+	}
+	h.state.Nh = nh
+	h.state.Ncc = (h.state.Ncc + 1) & 0x07
+	return append([]byte{}, nh...), h.state.Ncc, nil
+}
+
+// Nh returns the current NH (nil if none has been derived) and NCC
+func (h *KeyHierarchy) Nh() (nh []byte, ncc uint8) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.state.Nh != nil {
+		nh = append([]byte{}, h.state.Nh...)
+	}
+	return nh, h.state.Ncc
+}
+
+// RekeyKamf replaces KAMF with KAMF' derived with the given direction and NAS
+// COUNT (TS 33.501 A.13); KgNB and the NH chain are cleared
+func (h *KeyHierarchy) RekeyKamf(direction uint8, count uint32) (kamf []byte, err error) {
+	if direction != KAMF_PRIME_IDLE && direction != KAMF_PRIME_HANDOVER {
+		err = fmt.Errorf("Unknown KAMF' direction %d", direction)
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if kamf, err = KamfPrime(h.state.Kamf, []byte{direction}, binary.BigEndian.AppendUint32(nil, count)); err != nil {
+		return
+	}
+	h.state = KeyHierarchyState{Kamf: kamf}
+	return append([]byte{}, kamf...), nil
+}
@@ -0,0 +1,70 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKeyHierarchy(t *testing.T) {
+	kseaf, _ := hex.DecodeString("4c1e0a9f8d8e0d1f0e1d4a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d")
+	supi := []byte("208930000000001")
+	abba := []byte{0x00, 0x00}
+
+	h, err := NewKeyHierarchy(kseaf, supi, abba)
+	if err != nil {
+		t.Fatalf("NewKeyHierarchy failed: %+v", err)
+	}
+	kamf, _ := KAMF(kseaf, supi, abba)
+	if !bytes.Equal(h.Kamf(), kamf) {
+		t.Errorf("wrong KAMF")
+	}
+	if _, _, err = h.NextNh(); err == nil {
+		t.Errorf("NH without KgNB must fail")
+	}
+
+	kgnb, _ := h.DeriveKgnb(3, ACCESS_TYPE_3GPP)
+	ekgnb, _ := RanKey(kamf, []byte{0, 0, 0, 3}, []byte{ACCESS_TYPE_3GPP})
+	if !bytes.Equal(kgnb, ekgnb) {
+		t.Errorf("wrong KgNB")
+	}
+
+	//NH chain: NH1 = KDF(KAMF, KgNB), NHn+1 = KDF(KAMF, NHn)
+	sync := kgnb
+	for i := 1; i <= 9; i++ {
+		nh, ncc, err := h.NextNh()
+		if err != nil {
+			t.Fatalf("NextNh failed: %+v", err)
+		}
+		enh, _ := NhKey(kamf, sync)
+		if !bytes.Equal(nh, enh) || ncc != uint8(i%8) {
+			t.Errorf("wrong NH %d (NCC=%d)", i, ncc)
+		}
+		sync = enh
+	}
+
+	//export and restore
+	restored, err := RestoreKeyHierarchy(h.State())
+	if err != nil {
+		t.Fatalf("RestoreKeyHierarchy failed: %+v", err)
+	}
+	nh1, ncc1, _ := h.NextNh()
+	nh2, ncc2, _ := restored.NextNh()
+	if !bytes.Equal(nh1, nh2) || ncc1 != ncc2 {
+		t.Errorf("restored hierarchy diverges")
+	}
+
+	//a new initial AS context restarts the chain
+	if h.DeriveKgnb(4, ACCESS_TYPE_NON_3GPP); h.State().Ncc != 0 || h.State().Nh != nil {
+		t.Errorf("NH chain must restart")
+	}
+
+	kamfprime, _ := h.RekeyKamf(KAMF_PRIME_HANDOVER, 7)
+	ekamfprime, _ := KamfPrime(kamf, []byte{0x01}, []byte{0, 0, 0, 7})
+	if !bytes.Equal(kamfprime, ekamfprime) || !bytes.Equal(h.Kamf(), ekamfprime) {
+		t.Errorf("wrong KAMF'")
+	}
+	if h.State().Kgnb != nil {
+		t.Errorf("KgNB must be cleared after rekeying")
+	}
+}
@@ -0,0 +1,265 @@
+package sec5g
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// KeyHandle identifies a key kept inside a KeyProvider
+type KeyHandle string
+
+// KeyProvider keeps subscriber long-term keys and derived keys and runs the
+// operations needing them, so that callers only handle KeyHandles. The only
+// key returned in clear is KSEAF from SeAv, which the AUSF hands to the SEAF;
+// other derived keys stay in the provider and plain key buffers are zeroized
+// once an operation is done, including the ones given to the Import methods.
+//
+// Handles belong to the caller. Imported keys and session keys (KAUSF of a HE
+// AV, DeriveKey outputs) are kept until Delete: there is no expiry, so session
+// handles must be deleted once their security context is released.
+type KeyProvider interface {
+	//store K and OP/OPc (OPc is derived when isopc is false), k and opopc
+	//are zeroized once stored
+	ImportSubscriber(k, opopc []uint8, isopc bool) (KeyHandle, error)
+	//store a long-term key used as KDF input, key is zeroized once stored
+	ImportKey(key []byte) (KeyHandle, error)
+	//build a 5G HE AV of a subscriber for a RAND, KAUSF stays in the provider
+	HeAv(h KeyHandle, randv, sqn, amf []uint8, servingnet []byte) (*ProviderHeAv, error)
+	//derive the SE AV sent to the SEAF from a HE AV, with KSEAF in clear
+	SeAv(av *ProviderHeAv, servingnet []byte) (*SeAv, error)
+	//verify AUTS of a subscriber and return SQN_MS
+	ValidateAuts(h KeyHandle, auts, randv []byte) ([6]uint8, error)
+	//KDF with a stored key, the output is stored as a new session key
+	DeriveKey(h KeyHandle, fc uint8, param ...[]byte) (KeyHandle, error)
+	//delete a key and zeroize it
+	Delete(h KeyHandle) error
+}
+
+// 5G HE AV built inside a KeyProvider: only the values sent to the serving
+// network leave the provider
+type ProviderHeAv struct {
+	Rand      []uint8
+	Autn      []uint8 //SQN xor AK || AMF || MAC-A
+	XresStar  []uint8
+	HxresStar []uint8
+	Kausf     KeyHandle
+}
+
+const (
+	keyKindSubscriber uint8 = 1 //K || OPc
+	keyKindSecret     uint8 = 2 //KDF key
+)
+
+// storage backend of a provider: open returns a plain copy the caller must
+// zeroize. Session keys (derived in the provider) are never persisted.
+type keyStorage interface {
+	put(h KeyHandle, kind uint8, plain []byte, session bool) error
+	open(h KeyHandle) (kind uint8, plain []byte, err error)
+	remove(h KeyHandle) error
+}
+
+func zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func newKeyHandle() (KeyHandle, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return KeyHandle(hex.EncodeToString(buf[:])), nil
+}
+
+// operations shared by the providers
+type keyProvider struct {
+	storage keyStorage
+}
+
+func (p *keyProvider) store(kind uint8, plain []byte, session bool) (h KeyHandle, err error) {
+	if h, err = newKeyHandle(); err != nil {
+		return
+	}
+	if err = p.storage.put(h, kind, plain, session); err != nil {
+		return "", err
+	}
+	return
+}
+
+func (p *keyProvider) open(h KeyHandle, kind uint8) ([]byte, error) {
+	k, plain, err := p.storage.open(h)
+	if err != nil {
+		return nil, err
+	}
+	if k != kind {
+		zeroize(plain)
+		return nil, fmt.Errorf("Key %s has a wrong type", h)
+	}
+	return plain, nil
+}
+
+func (p *keyProvider) ImportSubscriber(k, opopc []uint8, isopc bool) (h KeyHandle, err error) {
+	var m *MilenageKey
+	if m, err = NewMilenageKey(k, opopc, isopc); err != nil {
+		return
+	}
+	plain := make([]byte, 0, 32)
+	plain = append(append(plain, k...), m.opc[:]...)
+	m.wipe()
+	h, err = p.store(keyKindSubscriber, plain, false)
+	zeroize(plain)
+	if err == nil {
+		zeroize(k)
+		zeroize(opopc)
+	}
+	return
+}
+
+func (p *keyProvider) ImportKey(key []byte) (h KeyHandle, err error) {
+	if len(key) == 0 {
+		err = fmt.Errorf("Empty key")
+		return
+	}
+	if h, err = p.store(keyKindSecret, key, false); err == nil {
+		zeroize(key)
+	}
+	return
+}
+
+// run f with a MilenageKey of the subscriber then zeroize it
+func (p *keyProvider) withMilenage(h KeyHandle, f func(*MilenageKey) error) error {
+	plain, err := p.open(h, keyKindSubscriber)
+	if err != nil {
+		return err
+	}
+	defer zeroize(plain)
+	m, err := NewMilenageKey(plain[:16], plain[16:], true)
+	if err != nil {
+		return err
+	}
+	defer m.wipe()
+	return f(m)
+}
+
+// CK and IK are zeroized once KAUSF and XRES* are derived (see GenerateHeAv)
+func (p *keyProvider) HeAv(h KeyHandle, randv, sqn, amf []uint8, servingnet []byte) (av *ProviderHeAv, err error) {
+	if err = checkHeAvInput(sqn, amf); err != nil {
+		return
+	}
+	var he *HeAv
+	err = p.withMilenage(h, func(m *MilenageKey) error {
+		out, e := m.Compute(randv, sqn, amf)
+		if e != nil {
+			return e
+		}
+		ckik := append(out.Ck, out.Ik...)
+		he, e = buildHeAv(randv, sqn, amf, out.MacA, out.Res, out.Ak, ckik, servingnet)
+		zeroize(ckik)
+		zeroize(out.Ck)
+		zeroize(out.Ik)
+		return e
+	})
+	if err != nil {
+		return
+	}
+	defer zeroize(he.Kausf)
+	av = &ProviderHeAv{
+		Rand:      he.Rand,
+		Autn:      he.Autn,
+		XresStar:  he.XresStar,
+		HxresStar: HxresStar(he.Rand, he.XresStar),
+	}
+	if av.Kausf, err = p.store(keyKindSecret, he.Kausf, true); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (p *keyProvider) SeAv(av *ProviderHeAv, servingnet []byte) (se *SeAv, err error) {
+	var kausf []byte
+	if kausf, err = p.open(av.Kausf, keyKindSecret); err != nil {
+		return
+	}
+	defer zeroize(kausf)
+	se = &SeAv{
+		Rand:      av.Rand,
+		Autn:      av.Autn,
+		HxresStar: av.HxresStar,
+	}
+	if se.Kseaf, err = SeafKey(kausf, servingnet); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (p *keyProvider) ValidateAuts(h KeyHandle, auts, randv []byte) (sqn [6]uint8, err error) {
+	err = p.withMilenage(h, func(m *MilenageKey) (e error) {
+		sqn, e = m.ValidateAuts(auts, randv)
+		return
+	})
+	return
+}
+
+func (p *keyProvider) DeriveKey(h KeyHandle, fc uint8, param ...[]byte) (derived KeyHandle, err error) {
+	var plain, sum []byte
+	if plain, err = p.open(h, keyKindSecret); err != nil {
+		return
+	}
+	sum = KDFWithFC(plain, fc, param...)
+	zeroize(plain)
+	derived, err = p.store(keyKindSecret, sum, true)
+	zeroize(sum)
+	return
+}
+
+func (p *keyProvider) Delete(h KeyHandle) error {
+	return p.storage.remove(h)
+}
+
+// in-memory storage
+type memoryKeyStorage struct {
+	keys  map[KeyHandle][]byte //kind || key
+	mutex sync.RWMutex
+}
+
+// NewMemoryKeyProvider creates a provider keeping keys in process memory
+func NewMemoryKeyProvider() KeyProvider {
+	return &keyProvider{
+		storage: &memoryKeyStorage{
+			keys: make(map[KeyHandle][]byte),
+		},
+	}
+}
+
+func (s *memoryKeyStorage) put(h KeyHandle, kind uint8, plain []byte, session bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[h] = append([]byte{kind}, plain...)
+	return nil
+}
+
+func (s *memoryKeyStorage) open(h KeyHandle) (kind uint8, plain []byte, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entry, ok := s.keys[h]
+	if !ok {
+		err = fmt.Errorf("Unknown key %s", h)
+		return
+	}
+	return entry[0], append([]byte{}, entry[1:]...), nil
+}
+
+func (s *memoryKeyStorage) remove(h KeyHandle) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.keys[h]
+	if !ok {
+		return fmt.Errorf("Unknown key %s", h)
+	}
+	zeroize(entry)
+	delete(s.keys, h)
+	return nil
+}
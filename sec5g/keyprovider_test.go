@@ -0,0 +1,125 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+)
+
+// plain copy of a key kept in a provider
+func providerKey(p KeyProvider, h KeyHandle) []byte {
+	_, plain, _ := p.(*keyProvider).storage.open(h)
+	return plain
+}
+
+func testKeyProvider(t *testing.T, p KeyProvider) {
+	k, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	op, _ := hex.DecodeString("cdc202d5123e20f62b6d676ac72cb318")
+	randv, _ := hex.DecodeString("23553cbe9637a89d218ae64dae47bf35")
+	sqn, _ := hex.DecodeString("ff9bb4d0b607")
+	amf := []uint8{0x80, 0x00}
+
+	imported := [][]uint8{append([]uint8{}, k...), append([]uint8{}, op...)}
+	h, err := p.ImportSubscriber(imported[0], imported[1], false)
+	if err != nil {
+		t.Fatalf("ImportSubscriber failed: %+v", err)
+	}
+	for _, b := range imported {
+		if !bytes.Equal(b, make([]uint8, len(b))) {
+			t.Errorf("imported buffer is not zeroized: %x", b)
+		}
+	}
+
+	//AUTS built with TS 35.208 test set 1 AK*
+	key, _ := NewMilenageKey(k, op, false)
+	akstar, _ := hex.DecodeString("451e8beca43b")
+	auts := append([]uint8{}, sqn...)
+	for i := range auts {
+		auts[i] ^= akstar[i]
+	}
+	_, macs, _ := key.F1(randv, sqn, []uint8{0, 0})
+	if ms, err := p.ValidateAuts(h, append(auts, macs...), randv); err != nil || !bytes.Equal(ms[:], sqn) {
+		t.Errorf("ValidateAuts failed: %x %+v", ms, err)
+	}
+
+	snn := []byte("5G:mnc093.mcc208.3gppnetwork.org")
+	if _, err = p.HeAv(h, randv, sqn, []uint8{0x00, 0x00}, snn); err == nil {
+		t.Errorf("AMF without separation bit must be rejected")
+	}
+	av, err := p.HeAv(h, randv, sqn, amf, snn)
+	if err != nil {
+		t.Fatalf("HeAv failed: %+v", err)
+	}
+	expected, _ := key.HeAv(randv, sqn, amf, snn)
+	if !bytes.Equal(av.Rand, randv) || !bytes.Equal(av.XresStar, expected.XresStar) || !bytes.Equal(av.Autn, expected.Autn) {
+		t.Errorf("wrong HE AV")
+	}
+	if !bytes.Equal(av.HxresStar, HxresStar(randv, expected.XresStar)) {
+		t.Errorf("wrong HXRES* %x", av.HxresStar)
+	}
+	if !bytes.Equal(providerKey(p, av.Kausf), expected.Kausf) {
+		t.Errorf("wrong KAUSF")
+	}
+
+	//KSEAF exported for the SEAF
+	se, err := p.SeAv(av, snn)
+	if err != nil {
+		t.Fatalf("SeAv failed: %+v", err)
+	}
+	expectedSe, _ := expected.SeAv(snn)
+	if !bytes.Equal(se.Kseaf, expectedSe.Kseaf) || !bytes.Equal(se.HxresStar, expectedSe.HxresStar) || !bytes.Equal(se.Autn, expectedSe.Autn) {
+		t.Errorf("wrong SE AV")
+	}
+
+	//KSEAF then KAMF inside the provider
+	kseaf, err := p.DeriveKey(av.Kausf, FC_KSEAF, snn)
+	if err != nil {
+		t.Fatalf("DeriveKey failed: %+v", err)
+	}
+	supi, abba := []byte("208930000000001"), []byte{0, 0}
+	kamf, err := p.DeriveKey(kseaf, FC_KAMF, supi, abba)
+	if err != nil {
+		t.Fatalf("DeriveKey failed: %+v", err)
+	}
+	plainKseaf, _ := SeafKey(expected.Kausf, snn)
+	expectedKamf, _ := KAMF(plainKseaf, supi, abba)
+	if !bytes.Equal(providerKey(p, kamf), expectedKamf) {
+		t.Errorf("wrong KAMF")
+	}
+
+	if _, err = p.DeriveKey(h, FC_KSEAF, snn); err == nil {
+		t.Errorf("subscriber key must not be usable as KDF key")
+	}
+	if _, err = p.HeAv(av.Kausf, randv, sqn, amf, snn); err == nil {
+		t.Errorf("KDF key must not be usable with Milenage")
+	}
+	if _, err = p.SeAv(&ProviderHeAv{Kausf: h}, snn); err == nil {
+		t.Errorf("subscriber key must not be usable as KAUSF")
+	}
+	if err = p.Delete(kseaf); err != nil {
+		t.Errorf("Delete failed: %+v", err)
+	}
+	if err = p.Delete(h); err != nil {
+		t.Errorf("Delete failed: %+v", err)
+	}
+	if _, err = p.HeAv(h, randv, sqn, amf, snn); err == nil {
+		t.Errorf("deleted key must not be usable")
+	}
+	if err = p.Delete(h); err == nil {
+		t.Errorf("deleting an unknown key must fail")
+	}
+}
+
+func TestMemoryKeyProvider(t *testing.T) {
+	testKeyProvider(t, NewMemoryKeyProvider())
+}
+
+func TestSoftHsmKeyProvider(t *testing.T) {
+	kek := bytes.Repeat([]byte{0x5a}, 32)
+	p, err := OpenSoftHsm(filepath.Join(t.TempDir(), "keys"), kek)
+	if err != nil {
+		t.Fatalf("OpenSoftHsm failed: %+v", err)
+	}
+	testKeyProvider(t, p)
+}
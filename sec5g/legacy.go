@@ -0,0 +1,113 @@
+package sec5g
+
+import "fmt"
+
+// GSM/UMTS conversion functions (TS 33.102 6.8.1.2), GSM-Milenage
+// (TS 55.205) and the EPS authentication vector (TS 33.401 6.1.2)
+
+// GSM authentication triplet
+type GsmTriplet struct {
+	Rand []uint8
+	Sres []uint8
+	Kc   []uint8
+}
+
+// EPS authentication vector
+type EpsAv struct {
+	Rand  []uint8
+	Xres  []uint8
+	Autn  []uint8 //SQN xor AK || AMF || MAC-A
+	Kasme []uint8
+}
+
+// C2 converts XRES (4 to 16 octets) into SRES: the XOR of its 32 bit blocks,
+// XRES being padded with zeros to 128 bits
+func C2(xres []uint8) (sres []uint8, err error) {
+	if len(xres) < 4 || len(xres) > 16 {
+		err = fmt.Errorf("Wrong XRES size")
+		return
+	}
+	sres = make([]uint8, 4)
+	for i, b := range xres {
+		sres[i%4] ^= b
+	}
+	return
+}
+
+// C3 converts CK and IK into Kc = CK1 xor CK2 xor IK1 xor IK2
+func C3(ck, ik []uint8) (kc []uint8, err error) {
+	if len(ck) != 16 || len(ik) != 16 {
+		err = fmt.Errorf("Wrong CK/IK size")
+		return
+	}
+	kc = make([]uint8, 8)
+	for i := 0; i < 8; i++ {
+		kc[i] = ck[i] ^ ck[i+8] ^ ik[i] ^ ik[i+8]
+	}
+	return
+}
+
+// function sets with their own GSM variant
+type gsmFunctions interface {
+	Gsm() (sres, kc []uint8)
+}
+
+// Gsm computes SRES and Kc for the current random vector. Function sets with
+// a GSM variant use it (GSM-Milenage), otherwise SRES and Kc come from the
+// conversion functions c2 and c3.
+func Gsm(f AuthFunctions) (sres, kc []uint8, err error) {
+	if g, ok := f.(gsmFunctions); ok {
+		sres, kc = g.Gsm()
+		return
+	}
+	res, _ := f.F2F5()
+	if sres, err = C2(res); err != nil {
+		return
+	}
+	kc, err = C3(f.F3(), f.F4())
+	return
+}
+
+// GenerateGsmTriplet builds a triplet with a new random vector
+func GenerateGsmTriplet(f AuthFunctions) (t *GsmTriplet, err error) {
+	f.Refresh()
+	t = &GsmTriplet{
+		Rand: append([]uint8{}, f.GetRand()...),
+	}
+	if t.Sres, t.Kc, err = Gsm(f); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// GenerateEpsAv builds an EPS AV with a new random vector for the serving
+// network id (3 octets PLMN identity). The AMF separation bit must be set.
+func GenerateEpsAv(f AuthFunctions, sqn, amf, snid []uint8) (av *EpsAv, err error) {
+	if err = checkHeAvInput(sqn, amf); err != nil {
+		return
+	}
+	f.Refresh()
+	var maca []uint8
+	if maca, _, err = f.F1(sqn, amf); err != nil {
+		return
+	}
+	res, ak := f.F2F5()
+	av = &EpsAv{
+		Rand: append([]uint8{}, f.GetRand()...),
+		Xres: append([]uint8{}, res...),
+		Autn: buildAutn(sqn, amf, maca, ak),
+	}
+	if av.Kasme, err = KASME(append(f.F3(), f.F4()...), snid, av.Autn[:6]); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Gsm runs GSM-Milenage (TS 55.205) for the current random vector: SRES is
+// the first 32 bits of RES and Kc comes from c3
+func (m *Milenage) Gsm() (sres, kc []uint8) {
+	res, _ := m.F2F5()
+	sres = append([]uint8{}, res[:4]...)
+	kc, _ = C3(m.F3(), m.F4()) //never fails with Milenage output sizes
+	return
+}
@@ -0,0 +1,93 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestGsmMilenage(t *testing.T) {
+	//TS 35.208 test set 1: SRES#1 comes from c2 (TS 33.102), SRES#2 from
+	//GSM-Milenage (TS 55.205)
+	k, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	opc, _ := hex.DecodeString("cd63cb71954a9f4e48a5994e37a02baf")
+	randv, _ := hex.DecodeString("23553cbe9637a89d218ae64dae47bf35")
+	m, _ := NewMilenage(k, opc, true)
+	m.SetRand(randv)
+	sres, kc := m.Gsm()
+	if hex.EncodeToString(sres) != "a54211d5" {
+		t.Errorf("wrong SRES#2 %x", sres)
+	}
+	if hex.EncodeToString(kc) != "eae4be823af9a08b" {
+		t.Errorf("wrong Kc %x", kc)
+	}
+	if sres2, kc2, _ := Gsm(m); !bytes.Equal(sres2, sres) || !bytes.Equal(kc2, kc) {
+		t.Errorf("Gsm must run GSM-Milenage for a Milenage")
+	}
+	res, _ := m.F2F5()
+	if sres, _ = C2(res); hex.EncodeToString(sres) != "46f8416a" {
+		t.Errorf("wrong SRES#1 %x", sres)
+	}
+
+	//other function sets use c2 and c3
+	top := bytes.Repeat([]uint8{0x55}, 32)
+	tk, _ := NewTuak(k, top, false)
+	sres, kc, _ = Gsm(tk)
+	res, _ = tk.F2F5()
+	if sres1, _ := C2(res); !bytes.Equal(sres, sres1) {
+		t.Errorf("wrong TUAK SRES %x", sres)
+	}
+	if kc1, _ := C3(tk.F3(), tk.F4()); !bytes.Equal(kc, kc1) {
+		t.Errorf("wrong TUAK Kc %x", kc)
+	}
+
+	sres, _ = C2([]uint8{1, 2, 3, 4, 5, 6})
+	if !bytes.Equal(sres, []uint8{1 ^ 5, 2 ^ 6, 3, 4}) {
+		t.Errorf("wrong SRES of a short XRES %x", sres)
+	}
+	if _, err := C2(make([]uint8, 3)); err == nil {
+		t.Errorf("short XRES must be rejected")
+	}
+	if _, err := C3(make([]uint8, 16), make([]uint8, 8)); err == nil {
+		t.Errorf("short IK must be rejected")
+	}
+
+	triplet, err := GenerateGsmTriplet(m)
+	if err != nil {
+		t.Fatalf("GenerateGsmTriplet failed: %+v", err)
+	}
+	m.SetRand(triplet.Rand)
+	sres, kc = m.Gsm()
+	if bytes.Equal(triplet.Rand, randv) || !bytes.Equal(sres, triplet.Sres) || !bytes.Equal(kc, triplet.Kc) {
+		t.Errorf("wrong triplet")
+	}
+}
+
+func TestEpsAv(t *testing.T) {
+	k, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	opc, _ := hex.DecodeString("cd63cb71954a9f4e48a5994e37a02baf")
+	sqn, _ := hex.DecodeString("ff9bb4d0b607")
+	snid := []uint8{0x02, 0xf8, 0x39}
+	m, _ := NewMilenage(k, opc, true)
+
+	if _, err := GenerateEpsAv(m, sqn, []uint8{0x00, 0x00}, snid); err == nil {
+		t.Errorf("AMF without separation bit must be rejected")
+	}
+	av, err := GenerateEpsAv(m, sqn, []uint8{0x80, 0x00}, snid)
+	if err != nil {
+		t.Fatalf("GenerateEpsAv failed: %+v", err)
+	}
+
+	//the USIM side accepts AUTN and derives the same KASME
+	result, err := VerifyAutn(m, av.Rand, av.Autn, make([]uint8, 6), nil)
+	if err != nil {
+		t.Fatalf("VerifyAutn failed: %+v", err)
+	}
+	if !bytes.Equal(result.Res, av.Xres) {
+		t.Errorf("RES %x differs from XRES %x", result.Res, av.Xres)
+	}
+	kasme, _ := KASME(append(result.Ck, result.Ik...), snid, av.Autn[:6])
+	if !bytes.Equal(kasme, av.Kasme) {
+		t.Errorf("wrong KASME %x", av.Kasme)
+	}
+}
@@ -9,35 +9,81 @@ import (
 	"io"
 )
 
-type Milenage struct {
-	block   cipher.Block
-	opc     [16]uint8
-	randxor [16]uint8 //E_k(rand XOR opc)
-	rand    [16]uint8
-	reader  io.Reader
+// operator customizable constants of Milenage (TS 35.206 4.1): c1..c5 and
+// the rotations r1..r5 in bits
+type MilenageConstants struct {
+	C [5][16]uint8
+	R [5]uint8
 }
 
-func NewMilenage(k []uint8, opopc []uint8, isopc bool) (m *Milenage, err error) {
-	//default rand reader
-	m, err = NewMilenageEx(k, rand.Reader, opopc, isopc)
+// standard constants: c1 = 0, c2..c5 = 1, 2, 4, 8; r = 64, 0, 32, 64, 96
+var defaultMilenageConstants = MilenageConstants{
+	C: [5][16]uint8{{}, {15: 1}, {15: 2}, {15: 4}, {15: 8}},
+	R: [5]uint8{64, 0, 32, 64, 96},
+}
+
+// DefaultMilenageConstants returns a copy of the standard constants
+func DefaultMilenageConstants() MilenageConstants {
+	return defaultMilenageConstants
+}
+
+func (c *MilenageConstants) validate() error {
+	for i := 0; i < 5; i++ {
+		if c.R[i] > 127 {
+			return fmt.Errorf("Wrong rotation r%d=%d", i+1, c.R[i])
+		}
+		for j := 0; j < i; j++ {
+			if c.C[i] == c.C[j] {
+				return fmt.Errorf("Constants c%d and c%d are equal", j+1, i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// dst = src cyclically rotated left by r bits
+func rotl128(dst, src *[16]uint8, r uint8) {
+	n, bits := int(r/8), r%8
+	for i := 0; i < 16; i++ {
+		b := src[(i+n)%16]
+		if bits != 0 {
+			b = b<<bits | src[(i+n+1)%16]>>(8-bits)
+		}
+		dst[i] = b
+	}
+}
+
+// MilenageKey is a subscriber's K and OPc. It keeps no per-vector state, so
+// one instance can be shared between goroutines: the RAND is given to each
+// call.
+type MilenageKey struct {
+	block  cipher.Block
+	opc    [16]uint8
+	consts MilenageConstants
+}
+
+func NewMilenageKey(k []uint8, opopc []uint8, isopc bool) (m *MilenageKey, err error) {
+	m, err = NewMilenageKeyWithConstants(k, opopc, isopc, nil)
 	return
 }
 
-// with customized rand reader
-func NewMilenageEx(k []uint8, r io.Reader, opopc []uint8, isopc bool) (m *Milenage, err error) {
+// with operator constants, nil means the standard ones
+func NewMilenageKeyWithConstants(k []uint8, opopc []uint8, isopc bool, consts *MilenageConstants) (m *MilenageKey, err error) {
 	if len(k) != 16 || len(opopc) != 16 {
 		err = fmt.Errorf("Wrong input size")
 		return
 	}
-	m = &Milenage{
-		reader: r,
+	m = &MilenageKey{
+		consts: defaultMilenageConstants,
 	}
-	if r == nil {
-		m.reader = rand.Reader
+	if consts != nil {
+		if err = consts.validate(); err != nil {
+			return nil, err
+		}
+		m.consts = *consts
 	}
-
 	if m.block, err = aes.NewCipher(k); err != nil {
-		return
+		return nil, err
 	}
 
 	//generate opc if it is needed
@@ -48,44 +94,33 @@ func NewMilenageEx(k []uint8, r io.Reader, opopc []uint8, isopc bool) (m *Milena
 		}
 	} else {
 		copy(m.opc[:], opopc[:])
-
 	}
-	m.Refresh()
 	return
 }
 
-// prepare a new random vector
-func (m *Milenage) Refresh() {
-	m.reader.Read(m.rand[:])
-	//	RAND, _ := hex.DecodeString("FEE14720A39CC164BCC0E3628452847C")
-	//copy(m.rand[:], RAND)
-	var tmp [16]uint8
-	for i := 0; i < 16; i++ {
-		tmp[i] = m.rand[i] ^ m.opc[i]
-	}
-	m.block.Encrypt(m.randxor[:], tmp[:])
+func (m *MilenageKey) Opc() []uint8 {
+	return append([]uint8{}, m.opc[:]...)
 }
 
-// set a new random vector
-func (m *Milenage) SetRand(r []uint8) error {
-	if len(r) != 16 {
+// zero OPc; the AES key schedule held by crypto/aes can not be cleared
+func (m *MilenageKey) wipe() {
+	zeroize(m.opc[:])
+}
+
+// E_k(rand XOR opc)
+func (m *MilenageKey) randXor(randv []uint8, randxor *[16]uint8) error {
+	if len(randv) != 16 {
 		return fmt.Errorf("Wrong rand size")
 	}
-	copy(m.rand[:], r)
 	var tmp [16]uint8
 	for i := 0; i < 16; i++ {
-		tmp[i] = m.rand[i] ^ m.opc[i]
+		tmp[i] = randv[i] ^ m.opc[i]
 	}
-	m.block.Encrypt(m.randxor[:], tmp[:])
+	m.block.Encrypt(randxor[:], tmp[:])
 	return nil
 }
 
-func (m *Milenage) GetRand() []uint8 {
-	return m.rand[:]
-}
-
-// f1 and f1star
-func (m *Milenage) F1(sqn, amf []uint8) (maca []uint8, macs []uint8, err error) {
+func (m *MilenageKey) f1(randxor *[16]uint8, sqn, amf []uint8) (maca []uint8, macs []uint8, err error) {
 	if len(sqn) != 6 || len(amf) != 2 {
 		err = fmt.Errorf("Wrong size input")
 		return
@@ -96,11 +131,13 @@ func (m *Milenage) F1(sqn, amf []uint8) (maca []uint8, macs []uint8, err error)
 	copy(b[6:], amf[:])
 	copy(b[8:], b[0:8])
 
-	// c = (rot(b XOR opc), 8) XOR randxor
-	var j int
+	// c = rot(b XOR opc, r1) XOR c1 XOR randxor
 	for i := 0; i < 16; i++ {
-		j = (i + 8) % 16
-		c[j] = b[i] ^ m.opc[i] ^ m.randxor[j]
+		b[i] ^= m.opc[i]
+	}
+	rotl128(&c, &b, m.consts.R[0])
+	for i := 0; i < 16; i++ {
+		c[i] ^= m.consts.C[0][i] ^ randxor[i]
 	}
 
 	// a = E_k(c) XOR opc
@@ -113,32 +150,16 @@ func (m *Milenage) F1(sqn, amf []uint8) (maca []uint8, macs []uint8, err error)
 	return
 }
 
-func (m *Milenage) F2F5() ([]uint8, []uint8) {
-	tmp := m.operation(0, 1)
-	return tmp[8:16], tmp[:6] // res, ak
-}
-
-func (m *Milenage) F3() []uint8 {
-	return m.operation(12, 2) //ck
-}
-
-func (m *Milenage) F4() []uint8 {
-	return m.operation(8, 4) //ik
-}
-
-func (m *Milenage) F5star() []uint8 {
-	tmp := m.operation(4, 8)
-	return tmp[:6] //akstar
-}
-
-func (m *Milenage) operation(rot int, v uint8) []uint8 {
-	var a, b, c [16]uint8
-	c[15] = v
-	var j int
-	//a= rotate(randxor XOR opc, rot) XOR c
+// output of f2..f5* with n = 2..5
+func (m *MilenageKey) operation(randxor *[16]uint8, n int) []uint8 {
+	var a, b [16]uint8
+	//a = rot(randxor XOR opc, r) XOR c
+	for i := 0; i < 16; i++ {
+		b[i] = randxor[i] ^ m.opc[i]
+	}
+	rotl128(&a, &b, m.consts.R[n-1])
 	for i := 0; i < 16; i++ {
-		j = (i + rot) % 16
-		a[j] = m.randxor[i] ^ m.opc[i] ^ c[j]
+		a[i] ^= m.consts.C[n-1][i]
 	}
 
 	//b = E_k(a) XOR opc
@@ -149,22 +170,88 @@ func (m *Milenage) operation(rot int, v uint8) []uint8 {
 	return b[:]
 }
 
-func (m *Milenage) ValidateAuts(auts, randv []byte) (sqn [6]uint8, err error) {
+// F1 computes f1 and f1* for the given RAND
+func (m *MilenageKey) F1(randv, sqn, amf []uint8) (maca []uint8, macs []uint8, err error) {
+	var randxor [16]uint8
+	if err = m.randXor(randv, &randxor); err != nil {
+		return
+	}
+	return m.f1(&randxor, sqn, amf)
+}
+
+// F2345 computes res, ck, ik and ak for the given RAND
+func (m *MilenageKey) F2345(randv []uint8) (res, ck, ik, ak []uint8, err error) {
+	var randxor [16]uint8
+	if err = m.randXor(randv, &randxor); err != nil {
+		return
+	}
+	tmp := m.operation(&randxor, 2)
+	res, ak = tmp[8:16], tmp[:6]
+	ck = m.operation(&randxor, 3)
+	ik = m.operation(&randxor, 4)
+	return
+}
 
+// F5star computes ak* for the given RAND
+func (m *MilenageKey) F5star(randv []uint8) (akstar []uint8, err error) {
+	var randxor [16]uint8
+	if err = m.randXor(randv, &randxor); err != nil {
+		return
+	}
+	akstar = m.operation(&randxor, 5)[:6]
+	return
+}
+
+// MilenageOutput holds all the function outputs of one RAND
+type MilenageOutput struct {
+	MacA   []uint8
+	MacS   []uint8
+	Res    []uint8
+	Ck     []uint8
+	Ik     []uint8
+	Ak     []uint8
+	AkStar []uint8
+}
+
+// Compute runs all the functions for a RAND, SQN and AMF with a single
+// E_k(rand XOR opc)
+func (m *MilenageKey) Compute(randv, sqn, amf []uint8) (out MilenageOutput, err error) {
+	var randxor [16]uint8
+	if err = m.randXor(randv, &randxor); err != nil {
+		return
+	}
+	if out.MacA, out.MacS, err = m.f1(&randxor, sqn, amf); err != nil {
+		return
+	}
+	tmp := m.operation(&randxor, 2)
+	out.Res, out.Ak = tmp[8:16], tmp[:6]
+	out.Ck = m.operation(&randxor, 3)
+	out.Ik = m.operation(&randxor, 4)
+	out.AkStar = m.operation(&randxor, 5)[:6]
+	return
+}
+
+// ValidateAuts verifies a resynchronization token for the given RAND and
+// returns SQN_MS
+func (m *MilenageKey) ValidateAuts(auts, randv []byte) (sqn [6]uint8, err error) {
 	if len(auts) != 14 || len(randv) != 16 {
 		err = fmt.Errorf("Wrong input size:auts[%d],rand[%d]", len(auts), len(randv))
 		return
 	}
+	var randxor [16]uint8
+	m.randXor(randv, &randxor) //never fails
+	sqn, err = m.validateAuts(&randxor, auts)
+	return
+}
 
-	m.SetRand(randv) //never fails
-
+func (m *MilenageKey) validateAuts(randxor *[16]uint8, auts []byte) (sqn [6]uint8, err error) {
 	var amf [2]uint8 //resync: dummy amf='0000'
 
-	ak_r := m.F5star()
+	ak_r := m.operation(randxor, 5)
 	for i := 0; i < 6; i++ {
 		sqn[i] = ak_r[i] ^ auts[i]
 	}
-	_, macs, _ := m.F1(sqn[:], amf[:]) //never fails
+	_, macs, _ := m.f1(randxor, sqn[:], amf[:]) //never fails
 
 	if bytes.Compare(macs, auts[6:]) != 0 {
 		err = fmt.Errorf("MAC failed: calculated MAC=%x, received MAC=%x", macs, auts[6:])
@@ -172,6 +259,119 @@ func (m *Milenage) ValidateAuts(auts, randv []byte) (sqn [6]uint8, err error) {
 	return
 }
 
+// HeAv builds a 5G HE AV for the given RAND (see GenerateHeAv)
+func (m *MilenageKey) HeAv(randv, sqn, amf []uint8, servingnet []byte) (av *HeAv, err error) {
+	if err = checkHeAvInput(sqn, amf); err != nil {
+		return
+	}
+	var out MilenageOutput
+	if out, err = m.Compute(randv, sqn, amf); err != nil {
+		return
+	}
+	av, err = buildHeAv(randv, sqn, amf, out.MacA, out.Res, out.Ak, append(out.Ck, out.Ik...), servingnet)
+	return
+}
+
+// Milenage is the stateful AuthFunctions implementation: it holds the
+// current RAND and must not be shared between goroutines
+type Milenage struct {
+	key     *MilenageKey
+	randxor [16]uint8 //E_k(rand XOR opc)
+	rand    [16]uint8
+	reader  io.Reader
+}
+
+func NewMilenage(k []uint8, opopc []uint8, isopc bool) (m *Milenage, err error) {
+	//default rand reader
+	m, err = NewMilenageEx(k, rand.Reader, opopc, isopc)
+	return
+}
+
+// with customized rand reader
+func NewMilenageEx(k []uint8, r io.Reader, opopc []uint8, isopc bool) (m *Milenage, err error) {
+	m, err = NewMilenageWithConstants(k, r, opopc, isopc, nil)
+	return
+}
+
+// with customized rand reader and operator constants
+func NewMilenageWithConstants(k []uint8, r io.Reader, opopc []uint8, isopc bool, consts *MilenageConstants) (m *Milenage, err error) {
+	var key *MilenageKey
+	if key, err = NewMilenageKeyWithConstants(k, opopc, isopc, consts); err != nil {
+		return
+	}
+	m = key.NewMilenage(r)
+	return
+}
+
+// NewMilenage creates a stateful function set sharing the key; a nil reader
+// means crypto/rand
+func (key *MilenageKey) NewMilenage(r io.Reader) *Milenage {
+	m := &Milenage{
+		key:    key,
+		reader: r,
+	}
+	if r == nil {
+		m.reader = rand.Reader
+	}
+	m.Refresh()
+	return m
+}
+
+// prepare a new random vector
+func (m *Milenage) Refresh() {
+	m.reader.Read(m.rand[:])
+	m.key.randXor(m.rand[:], &m.randxor)
+}
+
+// set a new random vector
+func (m *Milenage) SetRand(r []uint8) error {
+	if len(r) != 16 {
+		return fmt.Errorf("Wrong rand size")
+	}
+	copy(m.rand[:], r)
+	m.key.randXor(m.rand[:], &m.randxor)
+	return nil
+}
+
+func (m *Milenage) GetRand() []uint8 {
+	return m.rand[:]
+}
+
+// f1 and f1star
+func (m *Milenage) F1(sqn, amf []uint8) (maca []uint8, macs []uint8, err error) {
+	return m.key.f1(&m.randxor, sqn, amf)
+}
+
+func (m *Milenage) F2F5() ([]uint8, []uint8) {
+	tmp := m.key.operation(&m.randxor, 2)
+	return tmp[8:16], tmp[:6] // res, ak
+}
+
+func (m *Milenage) F3() []uint8 {
+	return m.key.operation(&m.randxor, 3) //ck
+}
+
+func (m *Milenage) F4() []uint8 {
+	return m.key.operation(&m.randxor, 4) //ik
+}
+
+func (m *Milenage) F5star() []uint8 {
+	tmp := m.key.operation(&m.randxor, 5)
+	return tmp[:6] //akstar
+}
+
+func (m *Milenage) ValidateAuts(auts, randv []byte) (sqn [6]uint8, err error) {
+
+	if len(auts) != 14 || len(randv) != 16 {
+		err = fmt.Errorf("Wrong input size:auts[%d],rand[%d]", len(auts), len(randv))
+		return
+	}
+
+	m.SetRand(randv) //never fails
+	sqn, err = m.key.validateAuts(&m.randxor, auts)
+	return
+}
+
 /*
 func OPC(k []uint8, op []uint8) (opc [16]uint8, err error) {
 	if len(k) != 16 || len(op) != 16 {
@@ -1,10 +1,14 @@
 package sec5g
 
 import (
+	"crypto/aes"
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"math/big"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -188,7 +192,7 @@ func TestAll(t *testing.T) {
 		ik := m.F4()
 		akstar := m.F5star()
 
-		if !reflect.DeepEqual(m.opc[:], eOPC) {
+		if !reflect.DeepEqual(m.key.opc[:], eOPC) {
 			t.Errorf("test generate OPC failed")
 		}
 		if !reflect.DeepEqual(a, f1) {
@@ -218,6 +222,12 @@ func TestAll(t *testing.T) {
 			t.Errorf("test AKstar failed")
 		}
 
+		key, _ := NewMilenageKey(K, OP, false)
+		out, err := key.Compute(RAND, SQN, AMF)
+		if err != nil || !reflect.DeepEqual(out, MilenageOutput{a, b, eRES, eCK, eIK, eAK, eAKstar}) {
+			t.Errorf("test stateless Milenage failed: %+v", err)
+		}
+
 	}
 	extra()
 	fmt.Printf("TestMilenage is done\n")
@@ -248,3 +258,206 @@ func extra() {
 	_, b, _ := m.F1(SQN, AMF)
 	fmt.Printf("ak=%x, macs=%x", ak, b)
 }
+
+func TestMilenageKeyConcurrent(t *testing.T) {
+	K, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	OPC, _ := hex.DecodeString("cd63cb71954a9f4e48a5994e37a02baf")
+	SQN, _ := hex.DecodeString("ff9bb4d0b607")
+	AMF, _ := hex.DecodeString("b9b9")
+	key, err := NewMilenageKey(K, OPC, true)
+	if err != nil {
+		t.Fatalf("NewMilenageKey failed: %+v", err)
+	}
+
+	//expected outputs computed serially with the stateful implementation
+	rands := make([][]uint8, 64)
+	expected := make([][]uint8, len(rands))
+	m, _ := NewMilenage(K, OPC, true)
+	for i := range rands {
+		rands[i] = make([]uint8, 16)
+		rands[i][0], rands[i][15] = uint8(i), uint8(3*i)
+		m.SetRand(rands[i])
+		maca, _, _ := m.F1(SQN, AMF)
+		res, _ := m.F2F5()
+		expected[i] = append(maca, res...)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				for i, r := range rands {
+					out, err := key.Compute(r, SQN, AMF)
+					if err != nil || !reflect.DeepEqual(append(out.MacA, out.Res...), expected[i]) {
+						t.Errorf("wrong output for rand %x", r)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err = key.Compute(make([]uint8, 15), SQN, AMF); err == nil {
+		t.Errorf("short rand must be rejected")
+	}
+	randv := rands[1]
+	akstar, _ := key.F5star(randv)
+	_, macs, _ := key.F1(randv, SQN, []uint8{0, 0})
+	auts := append([]uint8{}, SQN...)
+	for i := range auts {
+		auts[i] ^= akstar[i]
+	}
+	sqn, err := key.ValidateAuts(append(auts, macs...), randv)
+	if err != nil || !reflect.DeepEqual(sqn[:], SQN) {
+		t.Errorf("ValidateAuts failed: %x %+v", sqn, err)
+	}
+}
+
+func benchmarkInput() (k, opc, sqn, amf, snn []uint8) {
+	k, _ = hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	opc, _ = hex.DecodeString("cd63cb71954a9f4e48a5994e37a02baf")
+	sqn, _ = hex.DecodeString("ff9bb4d0b607")
+	amf, _ = hex.DecodeString("8000")
+	snn = []byte("5G:mnc093.mcc208.3gppnetwork.org")
+	return
+}
+
+func BenchmarkMilenageKeyCompute(b *testing.B) {
+	k, opc, sqn, amf, _ := benchmarkInput()
+	key, _ := NewMilenageKey(k, opc, true)
+	randv := make([]uint8, 16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key.Compute(randv, sqn, amf)
+	}
+}
+
+// a shared key generating HE AVs from concurrent requests
+func BenchmarkMilenageKeyHeAvParallel(b *testing.B) {
+	k, opc, sqn, amf, snn := benchmarkInput()
+	key, _ := NewMilenageKey(k, opc, true)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		randv := make([]uint8, 16)
+		for pb.Next() {
+			rand.Read(randv)
+			if _, err := key.HeAv(randv, sqn, amf, snn); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// one Milenage object (and AES cipher) per request
+func BenchmarkMilenageHeAvParallel(b *testing.B) {
+	k, opc, sqn, amf, snn := benchmarkInput()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := GenerateMilenageHeAv(k, opc, sqn, amf, snn); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// rotate left by r bits with math/big as an independent reference
+func bigRotl128(x []uint8, r uint) []uint8 {
+	v := new(big.Int).SetBytes(x)
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	v = new(big.Int).Or(new(big.Int).Lsh(v, r), new(big.Int).Rsh(v, 128-r))
+	out := make([]uint8, 16)
+	return new(big.Int).And(v, mask).FillBytes(out)
+}
+
+func TestMilenageConstants(t *testing.T) {
+	K, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	OPC, _ := hex.DecodeString("cd63cb71954a9f4e48a5994e37a02baf")
+	RAND, _ := hex.DecodeString("23553cbe9637a89d218ae64dae47bf35")
+	SQN, _ := hex.DecodeString("ff9bb4d0b607")
+	AMF, _ := hex.DecodeString("b9b9")
+
+	//the standard set given explicitly gives the standard outputs
+	std, _ := NewMilenageKey(K, OPC, true)
+	consts := DefaultMilenageConstants()
+	explicit, err := NewMilenageKeyWithConstants(K, OPC, true, &consts)
+	if err != nil {
+		t.Fatalf("NewMilenageKeyWithConstants failed: %+v", err)
+	}
+	o1, _ := std.Compute(RAND, SQN, AMF)
+	o2, _ := explicit.Compute(RAND, SQN, AMF)
+	if !reflect.DeepEqual(o1, o2) {
+		t.Errorf("explicit standard constants give different outputs")
+	}
+	//changing the returned copy does not change the default
+	consts.C[1][15] = 0x55
+	if std2, _ := NewMilenageKey(K, OPC, true); std2.consts != DefaultMilenageConstants() || DefaultMilenageConstants().C[1][15] != 1 {
+		t.Errorf("default constants have been changed")
+	}
+
+	consts = MilenageConstants{R: [5]uint8{13, 1, 127, 40, 77}}
+	for i := range consts.C {
+		for j := range consts.C[i] {
+			consts.C[i][j] = uint8(0x11*i + j)
+		}
+	}
+	custom, err := NewMilenageWithConstants(K, nil, OPC, true, &consts)
+	if err != nil {
+		t.Fatalf("NewMilenageWithConstants failed: %+v", err)
+	}
+	custom.SetRand(RAND)
+	res, ak := custom.F2F5()
+	if reflect.DeepEqual(res, o1.Res) {
+		t.Errorf("custom constants give the standard RES")
+	}
+
+	//f2 and f5 by hand: E_k(rot(E_k(RAND xor OPc) xor OPc, r2) xor c2) xor OPc
+	block, _ := aes.NewCipher(K)
+	temp := make([]uint8, 16)
+	for i := range temp {
+		temp[i] = RAND[i] ^ OPC[i]
+	}
+	block.Encrypt(temp, temp)
+	for i := range temp {
+		temp[i] ^= OPC[i]
+	}
+	out := bigRotl128(temp, uint(consts.R[1]))
+	for i := range out {
+		out[i] ^= consts.C[1][i]
+	}
+	block.Encrypt(out, out)
+	for i := range out {
+		out[i] ^= OPC[i]
+	}
+	if !reflect.DeepEqual(res, out[8:]) || !reflect.DeepEqual(ak, out[:6]) {
+		t.Errorf("wrong RES/AK with custom constants: %x %x", res, ak)
+	}
+
+	//resynchronization with the custom set
+	akstar := custom.F5star()
+	_, macs, _ := custom.F1(SQN, []uint8{0, 0})
+	auts := append([]uint8{}, SQN...)
+	for i := range auts {
+		auts[i] ^= akstar[i]
+	}
+	if sqn, err := custom.ValidateAuts(append(auts, macs...), RAND); err != nil || !reflect.DeepEqual(sqn[:], SQN) {
+		t.Errorf("ValidateAuts failed: %x %+v", sqn, err)
+	}
+
+	bad := consts
+	bad.R[2] = 128
+	if _, err = NewMilenageKeyWithConstants(K, OPC, true, &bad); err == nil {
+		t.Errorf("rotation of 128 bits must be rejected")
+	}
+	bad = consts
+	bad.C[4] = bad.C[0]
+	if _, err = NewMilenageKeyWithConstants(K, OPC, true, &bad); err == nil {
+		t.Errorf("equal constants must be rejected")
+	}
+}
@@ -0,0 +1,243 @@
+package sec5g
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 5G NAS security context (TS 33.501 6.4, TS 24.501 4.4 and 9.1)
+
+// security header types
+const (
+	NAS_SHT_PLAIN                          uint8 = 0
+	NAS_SHT_INTEGRITY                      uint8 = 1
+	NAS_SHT_INTEGRITY_CIPHERED             uint8 = 2
+	NAS_SHT_INTEGRITY_NEW_CONTEXT          uint8 = 3
+	NAS_SHT_INTEGRITY_CIPHERED_NEW_CONTEXT uint8 = 4
+)
+
+const (
+	NAS_EPD_5GMM uint8 = 0x7e
+
+	NAS_DIRECTION_UPLINK   uint8 = 0
+	NAS_DIRECTION_DOWNLINK uint8 = 1
+
+	//NAS connection identifiers, used as BEARER
+	NAS_ACCESS_3GPP     uint8 = 0
+	NAS_ACCESS_NON_3GPP uint8 = 1
+)
+
+const nasSecurityHeaderLen = 7
+
+var (
+	ErrNasMac    = errors.New("NAS message integrity check failed")
+	ErrNasReplay = errors.New("NAS message is replayed")
+)
+
+// NAS COUNT: 16 bit overflow || 8 bit sequence number
+type NasCount uint32
+
+func (c NasCount) Overflow() uint16 {
+	return uint16(c >> 8)
+}
+
+func (c NasCount) Sqn() uint8 {
+	return uint8(c)
+}
+
+type NasSecurityContext struct {
+	kNasEnc  []byte
+	kNasInt  []byte
+	encAlg   CipheringAlgorithm
+	intAlg   IntegrityAlgorithm
+	access   uint8
+	isUe     bool     //UE side sends uplink messages
+	tx       NasCount //next count to send
+	rx       NasCount //last received count
+	received bool     //a message has been received
+	inUse    bool     //counts started by a new context message or restored
+	mutex    sync.Mutex
+}
+
+// NewNasSecurityContext derives KNASenc/KNASint from KAMF for the selected
+// algorithms. isUe tells on which side the context is used.
+func NewNasSecurityContext(kamf []byte, encAlg CipheringAlgorithm, intAlg IntegrityAlgorithm, access uint8, isUe bool) (ctx *NasSecurityContext, err error) {
+	ctx = &NasSecurityContext{
+		encAlg: encAlg,
+		intAlg: intAlg,
+		access: access,
+		isUe:   isUe,
+	}
+	if ctx.kNasEnc, err = KNasEnc(kamf, encAlg); err != nil {
+		return nil, err
+	}
+	if ctx.kNasInt, err = KNasInt(kamf, intAlg); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (ctx *NasSecurityContext) Algorithms() (CipheringAlgorithm, IntegrityAlgorithm) {
+	return ctx.encAlg, ctx.intAlg
+}
+
+// Counts returns the uplink and downlink NAS COUNT: the next one to be sent
+// and the last one received
+func (ctx *NasSecurityContext) Counts() (ul NasCount, dl NasCount) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	if ctx.isUe {
+		return ctx.tx, ctx.rx
+	}
+	return ctx.rx, ctx.tx
+}
+
+// SetCounts restores the counts (e.g. after loading a stored context)
+func (ctx *NasSecurityContext) SetCounts(tx NasCount, rx NasCount, received bool) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	ctx.tx, ctx.rx, ctx.received = tx&0xffffff, rx&0xffffff, received
+	ctx.inUse = true
+}
+
+func isNewContextSht(sht uint8) bool {
+	return sht == NAS_SHT_INTEGRITY_NEW_CONTEXT || sht == NAS_SHT_INTEGRITY_CIPHERED_NEW_CONTEXT
+}
+
+// a new context security header type takes the context into use: its counts
+// start from zero (TS 24.501 4.4.3.1). Later new context messages (e.g. the
+// SECURITY MODE COMPLETE answering a SECURITY MODE COMMAND) keep the counts.
+func (ctx *NasSecurityContext) startsContext(sht uint8) bool {
+	return isNewContextSht(sht) && !ctx.inUse
+}
+
+func (ctx *NasSecurityContext) direction(sending bool) uint8 {
+	if ctx.isUe == sending {
+		return NAS_DIRECTION_UPLINK
+	}
+	return NAS_DIRECTION_DOWNLINK
+}
+
+// Protect builds a security protected 5GMM message from a plain one:
+// EPD || SHT || MAC || SN || (ciphered) message. The sending COUNT is
+// incremented. A new context header type resets the counts of a context not
+// yet taken into use.
+func (ctx *NasSecurityContext) Protect(msg []byte, sht uint8) (pdu []byte, err error) {
+	switch sht {
+	case NAS_SHT_PLAIN:
+		return msg, nil
+	case NAS_SHT_INTEGRITY, NAS_SHT_INTEGRITY_CIPHERED, NAS_SHT_INTEGRITY_NEW_CONTEXT, NAS_SHT_INTEGRITY_CIPHERED_NEW_CONTEXT:
+	default:
+		return nil, fmt.Errorf("Unknown security header type %d", sht)
+	}
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+
+	if ctx.startsContext(sht) {
+		ctx.tx, ctx.rx, ctx.received = 0, 0, false
+		ctx.inUse = true
+	}
+	count := ctx.tx
+	dir := ctx.direction(true)
+	payload := msg
+	if sht == NAS_SHT_INTEGRITY_CIPHERED || sht == NAS_SHT_INTEGRITY_CIPHERED_NEW_CONTEXT {
+		if payload, err = ctx.encAlg.Cipher(ctx.kNasEnc, uint32(count), ctx.access, dir, msg, uint32(8*len(msg))); err != nil {
+			return
+		}
+	}
+	pdu = make([]byte, nasSecurityHeaderLen, nasSecurityHeaderLen+len(payload))
+	pdu[0] = NAS_EPD_5GMM
+	pdu[1] = sht
+	pdu[6] = count.Sqn()
+	pdu = append(pdu, payload...)
+
+	var mac []byte
+	if mac, err = ctx.intAlg.Mac(ctx.kNasInt, uint32(count), ctx.access, dir, pdu[6:], uint32(8*(len(pdu)-6))); err != nil {
+		return nil, err
+	}
+	copy(pdu[2:6], mac)
+	ctx.tx = (ctx.tx + 1) & 0xffffff
+	return
+}
+
+// EstimateCount estimates the NAS COUNT of a received message from its 8 bit
+// sequence number and the last received COUNT (TS 24.501 4.4.3.1)
+func (ctx *NasSecurityContext) EstimateCount(sqn uint8) NasCount {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.estimate(sqn)
+}
+
+func (ctx *NasSecurityContext) estimate(sqn uint8) NasCount {
+	return estimateNasCount(ctx.rx, ctx.received, sqn)
+}
+
+func estimateNasCount(rx NasCount, received bool, sqn uint8) NasCount {
+	overflow := rx.Overflow()
+	if received && sqn < rx.Sqn() {
+		overflow++
+	}
+	return NasCount(overflow)<<8 | NasCount(sqn)
+}
+
+// Unprotect verifies and deciphers a received 5GMM message and returns the
+// plain message with its security header type. Messages failing the
+// integrity check (ErrNasMac) or reusing a COUNT (ErrNasReplay) are
+// rejected without changing the context. A verified new context header type
+// resets the counts of a context not yet taken into use.
+func (ctx *NasSecurityContext) Unprotect(pdu []byte) (msg []byte, sht uint8, err error) {
+	if len(pdu) < 2 || pdu[0] != NAS_EPD_5GMM {
+		return nil, 0, fmt.Errorf("Not a 5GMM message")
+	}
+	if sht = pdu[1] & 0x0f; sht == NAS_SHT_PLAIN {
+		return pdu, sht, nil
+	}
+	if sht > NAS_SHT_INTEGRITY_CIPHERED_NEW_CONTEXT {
+		return nil, sht, fmt.Errorf("Unknown security header type %d", sht)
+	}
+	if len(pdu) <= nasSecurityHeaderLen {
+		return nil, sht, fmt.Errorf("Security protected message is too short")
+	}
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+
+	//a new context is checked against zero counts, they are only reset once
+	//the message is verified
+	rx, received := ctx.rx, ctx.received
+	starting := ctx.startsContext(sht)
+	if starting {
+		rx, received = 0, false
+	}
+	count := estimateNasCount(rx, received, pdu[6])
+	dir := ctx.direction(false)
+	if received && count <= rx {
+		return nil, sht, ErrNasReplay
+	}
+	if ctx.intAlg != ALG_NIA0 {
+		var mac []byte
+		if mac, err = ctx.intAlg.Mac(ctx.kNasInt, uint32(count), ctx.access, dir, pdu[6:], uint32(8*(len(pdu)-6))); err != nil {
+			return nil, sht, err
+		}
+		for i := 0; i < 4; i++ {
+			if mac[i] != pdu[2+i] {
+				return nil, sht, ErrNasMac
+			}
+		}
+	}
+	msg = pdu[nasSecurityHeaderLen:]
+	if sht == NAS_SHT_INTEGRITY_CIPHERED || sht == NAS_SHT_INTEGRITY_CIPHERED_NEW_CONTEXT {
+		if msg, err = ctx.encAlg.Cipher(ctx.kNasEnc, uint32(count), ctx.access, dir, msg, uint32(8*len(msg))); err != nil {
+			return nil, sht, err
+		}
+	} else {
+		msg = append([]byte{}, msg...)
+	}
+	if starting {
+		ctx.tx = 0
+		ctx.inUse = true
+	}
+	ctx.rx = count
+	ctx.received = true
+	return
+}
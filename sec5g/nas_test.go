@@ -0,0 +1,135 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestNasSecurityContext(t *testing.T) {
+	kamf, _ := hex.DecodeString("b3a80f5b7f2d1a6c2b5d0e9f8a7c6b5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b")
+	//registration accept like payload
+	msg, _ := hex.DecodeString("7e0042010177000bf202f8398000010000000154070002f83900000115020101")
+
+	for enc := ALG_NEA0; enc <= ALG_NEA3; enc++ {
+		for integ := ALG_NIA1; integ <= ALG_NIA3; integ++ {
+			amf, err := NewNasSecurityContext(kamf, enc, integ, NAS_ACCESS_3GPP, false)
+			if err != nil {
+				t.Fatalf("failed to create context: %+v", err)
+			}
+			ue, _ := NewNasSecurityContext(kamf, enc, integ, NAS_ACCESS_3GPP, true)
+
+			for i := 0; i < 3; i++ {
+				pdu, err := amf.Protect(msg, NAS_SHT_INTEGRITY_CIPHERED)
+				if err != nil {
+					t.Fatalf("%s/%s: Protect failed: %+v", enc, integ, err)
+				}
+				if pdu[0] != NAS_EPD_5GMM || pdu[1] != NAS_SHT_INTEGRITY_CIPHERED || pdu[6] != uint8(i) {
+					t.Errorf("%s/%s: wrong security header %x", enc, integ, pdu[:7])
+				}
+				if enc != ALG_NEA0 && bytes.Equal(pdu[7:], msg) {
+					t.Errorf("%s/%s: message is not ciphered", enc, integ)
+				}
+				plain, sht, err := ue.Unprotect(pdu)
+				if err != nil || sht != NAS_SHT_INTEGRITY_CIPHERED || !bytes.Equal(plain, msg) {
+					t.Errorf("%s/%s: Unprotect failed: %v", enc, integ, err)
+				}
+				if _, _, err = ue.Unprotect(pdu); !errors.Is(err, ErrNasReplay) {
+					t.Errorf("%s/%s: replay must be detected: %v", enc, integ, err)
+				}
+			}
+
+			//uplink
+			pdu, _ := ue.Protect(msg, NAS_SHT_INTEGRITY)
+			if !bytes.Equal(pdu[7:], msg) {
+				t.Errorf("%s/%s: integrity only message must be plain", enc, integ)
+			}
+			pdu[len(pdu)-1] ^= 0x01
+			if _, _, err = amf.Unprotect(pdu); !errors.Is(err, ErrNasMac) {
+				t.Errorf("%s/%s: tampered message must be rejected: %v", enc, integ, err)
+			}
+			ul, dl := ue.Counts()
+			if ul != 1 || dl != 2 {
+				t.Errorf("%s/%s: wrong counts %d %d", enc, integ, ul, dl)
+			}
+		}
+	}
+}
+
+func TestNasCountEstimation(t *testing.T) {
+	kamf := make([]byte, 32)
+	amf, _ := NewNasSecurityContext(kamf, ALG_NEA2, ALG_NIA2, NAS_ACCESS_3GPP, false)
+	ue, _ := NewNasSecurityContext(kamf, ALG_NEA2, ALG_NIA2, NAS_ACCESS_3GPP, true)
+	amf.SetCounts(0x0001ff, 0, false)
+	ue.SetCounts(0, 0x0001fd, true)
+
+	//one lost message before the sequence number wraps
+	amf.Protect([]byte{0x7e, 0x00, 0x54}, NAS_SHT_INTEGRITY)
+	pdu, _ := amf.Protect([]byte{0x7e, 0x00, 0x54}, NAS_SHT_INTEGRITY)
+	if c := ue.EstimateCount(pdu[6]); c != 0x000200 || c.Overflow() != 2 || c.Sqn() != 0 {
+		t.Errorf("wrong estimated count %06x", c)
+	}
+	if _, _, err := ue.Unprotect(pdu); err != nil {
+		t.Errorf("Unprotect failed: %+v", err)
+	}
+	if _, dl := ue.Counts(); dl != 0x000200 {
+		t.Errorf("wrong downlink count %06x", dl)
+	}
+
+	//the NAS MAC is NIA2 over SN || message with the downlink COUNT
+	ctx, _ := NewNasSecurityContext(kamf, ALG_NEA0, ALG_NIA2, NAS_ACCESS_3GPP, false)
+	pdu, _ = ctx.Protect([]byte{0x7e, 0x00, 0x54}, NAS_SHT_INTEGRITY)
+	mac, _ := NIA2(ctx.kNasInt, 0, NAS_ACCESS_3GPP, NAS_DIRECTION_DOWNLINK, pdu[6:], 32)
+	if !bytes.Equal(mac, pdu[2:6]) {
+		t.Errorf("wrong NAS MAC %x", pdu[2:6])
+	}
+}
+
+func TestNasNewContext(t *testing.T) {
+	kamf := make([]byte, 32)
+	amf, _ := NewNasSecurityContext(kamf, ALG_NEA2, ALG_NIA2, NAS_ACCESS_3GPP, false)
+	ue, _ := NewNasSecurityContext(kamf, ALG_NEA2, ALG_NIA2, NAS_ACCESS_3GPP, true)
+	msg := []byte{0x7e, 0x00, 0x5d}
+	for i := 0; i < 3; i++ {
+		pdu, _ := amf.Protect(msg, NAS_SHT_INTEGRITY_CIPHERED)
+		ue.Unprotect(pdu)
+		pdu, _ = ue.Protect(msg, NAS_SHT_INTEGRITY_CIPHERED)
+		amf.Unprotect(pdu)
+	}
+
+	//SECURITY MODE COMMAND taking the context into use
+	smc, err := amf.Protect(msg, NAS_SHT_INTEGRITY_NEW_CONTEXT)
+	if err != nil || smc[6] != 0 {
+		t.Fatalf("new context message must be sent with COUNT 0: %v", err)
+	}
+	tampered := append([]byte{}, smc...)
+	tampered[2] ^= 0x01
+	if _, _, err = ue.Unprotect(tampered); !errors.Is(err, ErrNasMac) {
+		t.Errorf("tampered message must be rejected: %v", err)
+	}
+	if ul, dl := ue.Counts(); ul != 3 || dl != 2 {
+		t.Errorf("a rejected message must not reset the counts: %d %d", ul, dl)
+	}
+	if _, sht, err := ue.Unprotect(smc); err != nil || sht != NAS_SHT_INTEGRITY_NEW_CONTEXT {
+		t.Fatalf("new context message is rejected: %v", err)
+	}
+	if ul, dl := ue.Counts(); ul != 0 || dl != 0 {
+		t.Errorf("wrong counts in the new context: %d %d", ul, dl)
+	}
+
+	//SECURITY MODE COMPLETE keeps the counts of the started context
+	complete, _ := ue.Protect(msg, NAS_SHT_INTEGRITY_CIPHERED_NEW_CONTEXT)
+	if complete[6] != 0 {
+		t.Errorf("wrong uplink sequence number %d", complete[6])
+	}
+	if _, _, err = amf.Unprotect(complete); err != nil {
+		t.Errorf("new context message is rejected: %v", err)
+	}
+	if _, _, err = ue.Unprotect(smc); !errors.Is(err, ErrNasReplay) {
+		t.Errorf("replay must be detected: %v", err)
+	}
+	if ul, dl := amf.Counts(); ul != 0 || dl != 1 {
+		t.Errorf("wrong counts %d %d", ul, dl)
+	}
+}
@@ -0,0 +1,127 @@
+package sec5g
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// 128-NEA2/128-NIA2 (TS 33.501 Annex D.4, TS 33.401 Annex B.1/B.2)
+
+// check the key and data size then return a copy of the first length bits
+// of data
+func nasAlgInput(key, data []byte, length uint32) ([]byte, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("Wrong key size")
+	}
+	n := int((length + 7) / 8)
+	if len(data) < n {
+		return nil, fmt.Errorf("Data is shorter than %d bits", length)
+	}
+	return append([]byte{}, data[:n]...), nil
+}
+
+// zero the bits after length in the last byte
+func maskTail(buf []byte, length uint32) {
+	if r := length % 8; r != 0 {
+		buf[len(buf)-1] &= 0xff << (8 - r)
+	}
+}
+
+// NEA2 ciphers (or deciphers) the first length bits of data with AES-CTR
+func NEA2(key []byte, count uint32, bearer, direction uint8, data []byte, length uint32) (out []byte, err error) {
+	if out, err = nasAlgInput(key, data, length); err != nil {
+		return
+	}
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+	//IV = COUNT || BEARER || DIRECTION || 0...0
+	var iv [16]byte
+	binary.BigEndian.PutUint32(iv[0:], count)
+	iv[4] = (bearer&0x1f)<<3 | (direction&0x01)<<2
+	cipher.NewCTR(block, iv[:]).XORKeyStream(out, out)
+	maskTail(out, length)
+	return
+}
+
+// NIA2 computes the 32 bit MAC-I/NAS-MAC over the first length bits of data
+// with AES-CMAC
+func NIA2(key []byte, count uint32, bearer, direction uint8, data []byte, length uint32) (mac []byte, err error) {
+	var msg []byte
+	if msg, err = nasAlgInput(key, data, length); err != nil {
+		return
+	}
+	maskTail(msg, length)
+	//M = COUNT || BEARER || DIRECTION || 0...0 || MESSAGE
+	m := make([]byte, 8, 8+len(msg))
+	binary.BigEndian.PutUint32(m[0:], count)
+	m[4] = (bearer&0x1f)<<3 | (direction&0x01)<<2
+	m = append(m, msg...)
+
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+	mac = cmac(block, m, 64+uint64(length))[:4]
+	return
+}
+
+// AES-CMAC (RFC 4493, NIST SP 800-38B) over the first bits of msg
+func cmac(block cipher.Block, msg []byte, bits uint64) []byte {
+	var k1, k2, l [16]byte
+	block.Encrypt(l[:], l[:])
+	cmacShift(&k1, &l)
+	cmacShift(&k2, &k1)
+
+	n := int((bits + 127) / 128)
+	complete := bits > 0 && bits%128 == 0
+	if n == 0 {
+		n = 1
+	}
+
+	var x, y [16]byte
+	for i := 0; i < n-1; i++ {
+		for j := 0; j < 16; j++ {
+			y[j] = x[j] ^ msg[16*i+j]
+		}
+		block.Encrypt(x[:], y[:])
+	}
+
+	//last block
+	var last [16]byte
+	rest := bits - 128*uint64(n-1)
+	copy(last[:], msg[16*(n-1):(bits+7)/8])
+	if complete {
+		for j := 0; j < 16; j++ {
+			last[j] ^= k1[j]
+		}
+	} else {
+		//pad with a single one bit followed by zeros
+		last[rest/8] &= 0xff << (8 - rest%8)
+		last[rest/8] |= 0x80 >> (rest % 8)
+		for j := 0; j < 16; j++ {
+			last[j] ^= k2[j]
+		}
+	}
+	for j := 0; j < 16; j++ {
+		y[j] = x[j] ^ last[j]
+	}
+	block.Encrypt(x[:], y[:])
+	return x[:]
+}
+
+// subkey generation: left shift by one bit with a conditional XOR of Rb
+func cmacShift(dst, src *[16]byte) {
+	var carry byte
+	for i := 15; i >= 0; i-- {
+		b := src[i]
+		dst[i] = b<<1 | carry
+		carry = b >> 7
+	}
+	if carry != 0 {
+		dst[15] ^= 0x87
+	}
+}
@@ -0,0 +1,104 @@
+package sec5g
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+type NasAlgTestCase struct {
+	Key       string
+	Count     uint32
+	Bearer    uint8
+	Direction uint8
+	Length    uint32
+	Input     string
+	Output    string //ciphertext or MAC
+}
+
+func TestCmac(t *testing.T) {
+	//RFC 4493 examples 1-4
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	msg, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	expected := map[int]string{
+		0:  "bb1d6929e95937287fa37d129b756746",
+		16: "070a16b46b4d4144f79bdd9dd04a287c",
+		40: "dfa66747de9ae63030ca32611497c827",
+		64: "51f0bebf7e3b9d92fc49741779363cfe",
+	}
+	block, _ := aes.NewCipher(key)
+	for l, v := range expected {
+		if mac := cmac(block, msg[:l], 8*uint64(l)); hex.EncodeToString(mac) != v {
+			t.Errorf("wrong CMAC for %d bytes: %x", l, mac)
+		}
+	}
+}
+
+func TestNEA2(t *testing.T) {
+	//TS 33.401 C.1
+	table := []NasAlgTestCase{
+		{
+			Key:       "d3c5d592327fb11c4035c6680af8c6d1",
+			Count:     0x398a59b4,
+			Bearer:    0x15,
+			Direction: 1,
+			Length:    253,
+			Input:     "981ba6824c1bfb1ab485472029b71d808ce33e2cc3c0b5fc1f3de8a6dc66b1f0",
+			Output:    "e9fed8a63d155304d71df20bf3e82214b20ed7dad2f233dc3c22d7bdeeed8e78",
+		},
+	}
+	for i, tc := range table {
+		key, _ := hex.DecodeString(tc.Key)
+		in, _ := hex.DecodeString(tc.Input)
+		out, err := NEA2(key, tc.Count, tc.Bearer, tc.Direction, in, tc.Length)
+		if err != nil {
+			t.Fatalf("[%d] NEA2 failed: %+v", i, err)
+		}
+		if hex.EncodeToString(out) != tc.Output {
+			t.Errorf("[%d] wrong ciphertext %x", i, out)
+		}
+		plain, _ := NEA2(key, tc.Count, tc.Bearer, tc.Direction, out, tc.Length)
+		maskTail(in, tc.Length)
+		if hex.EncodeToString(plain) != hex.EncodeToString(in) {
+			t.Errorf("[%d] wrong deciphered text %x", i, plain)
+		}
+	}
+}
+
+func TestNIA2(t *testing.T) {
+	//TS 33.401 C.2
+	table := []NasAlgTestCase{
+		{
+			Key:       "2bd6459f82c5b300952c49104881ff48",
+			Count:     0x38a6f056,
+			Bearer:    0x18,
+			Direction: 0,
+			Length:    58,
+			Input:     "3332346263393840",
+			Output:    "118c6eb8",
+		},
+		{
+			Key:       "d3c5d592327fb11c4035c6680af8c6d1",
+			Count:     0x398a59b4,
+			Bearer:    0x1a,
+			Direction: 1,
+			Length:    64,
+			Input:     "484583d5afe082ae",
+			Output:    "b93787e6",
+		},
+	}
+	for i, tc := range table {
+		key, _ := hex.DecodeString(tc.Key)
+		in, _ := hex.DecodeString(tc.Input)
+		mac, err := NIA2(key, tc.Count, tc.Bearer, tc.Direction, in, tc.Length)
+		if err != nil {
+			t.Fatalf("[%d] NIA2 failed: %+v", i, err)
+		}
+		if hex.EncodeToString(mac) != tc.Output {
+			t.Errorf("[%d] wrong MAC %x", i, mac)
+		}
+	}
+	if _, err := NIA2(make([]byte, 16), 0, 0, 0, make([]byte, 2), 17); err == nil {
+		t.Errorf("too short data must be rejected")
+	}
+}
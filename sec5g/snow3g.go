@@ -0,0 +1,229 @@
+package sec5g
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SNOW 3G keystream generator (ETSI/SAGE UEA2 & UIA2 Document 2) and the
+// 128-NEA1/128-NIA1 algorithms built on it (TS 33.401 Annex B)
+
+var (
+	snowSR  [256]uint8 //AES S-box
+	snowSQ  [256]uint8 //S-box derived from the Dickson polynomial
+	snowMul [256]uint32
+	snowDiv [256]uint32
+)
+
+func init() {
+	//SR: multiplicative inverse in GF(2^8) mod x^8+x^4+x^3+x+1 followed by
+	//the AES affine transform
+	var inv [256]uint8
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if gfMul(uint8(a), uint8(b), 0x1b) == 1 {
+				inv[a] = uint8(b)
+				break
+			}
+		}
+	}
+	for x := 0; x < 256; x++ {
+		b := inv[x]
+		snowSR[x] = b ^ rotl8(b, 1) ^ rotl8(b, 2) ^ rotl8(b, 3) ^ rotl8(b, 4) ^ 0x63
+	}
+
+	//SQ(x) = x + x^9 + x^13 + x^15 + x^33 + x^41 + x^45 + x^47 + x^49 + 0x25
+	//in GF(2^8) mod x^8+x^6+x^5+x^3+1
+	for x := 0; x < 256; x++ {
+		var pow [50]uint8
+		pow[1] = uint8(x)
+		for i := 2; i < 50; i++ {
+			pow[i] = gfMul(pow[i-1], uint8(x), 0x69)
+		}
+		snowSQ[x] = pow[1] ^ pow[9] ^ pow[13] ^ pow[15] ^ pow[33] ^ pow[41] ^ pow[45] ^ pow[47] ^ pow[49] ^ 0x25
+	}
+
+	for c := 0; c < 256; c++ {
+		v := uint8(c)
+		snowMul[c] = uint32(mulxPow(v, 23, 0xa9))<<24 | uint32(mulxPow(v, 245, 0xa9))<<16 |
+			uint32(mulxPow(v, 48, 0xa9))<<8 | uint32(mulxPow(v, 239, 0xa9))
+		snowDiv[c] = uint32(mulxPow(v, 16, 0xa9))<<24 | uint32(mulxPow(v, 39, 0xa9))<<16 |
+			uint32(mulxPow(v, 6, 0xa9))<<8 | uint32(mulxPow(v, 64, 0xa9))
+	}
+}
+
+func rotl8(b uint8, n uint) uint8 {
+	return b<<n | b>>(8-n)
+}
+
+func mulx(v, c uint8) uint8 {
+	if v&0x80 != 0 {
+		return v<<1 ^ c
+	}
+	return v << 1
+}
+
+func mulxPow(v uint8, i int, c uint8) uint8 {
+	for ; i > 0; i-- {
+		v = mulx(v, c)
+	}
+	return v
+}
+
+// multiplication in GF(2^8) with the reduction byte c
+func gfMul(a, b, c uint8) (r uint8) {
+	for ; b != 0; b >>= 1 {
+		if b&1 != 0 {
+			r ^= a
+		}
+		a = mulx(a, c)
+	}
+	return
+}
+
+func snowS(w uint32, box *[256]uint8, c uint8) uint32 {
+	s0 := box[uint8(w>>24)]
+	s1 := box[uint8(w>>16)]
+	s2 := box[uint8(w>>8)]
+	s3 := box[uint8(w)]
+	r0 := mulx(s0, c) ^ s1 ^ s2 ^ mulx(s3, c) ^ s3
+	r1 := mulx(s0, c) ^ s0 ^ mulx(s1, c) ^ s2 ^ s3
+	r2 := s0 ^ mulx(s1, c) ^ s1 ^ mulx(s2, c) ^ s3
+	r3 := s0 ^ s1 ^ mulx(s2, c) ^ s2 ^ mulx(s3, c)
+	return uint32(r0)<<24 | uint32(r1)<<16 | uint32(r2)<<8 | uint32(r3)
+}
+
+type snow3g struct {
+	s          [16]uint32
+	r1, r2, r3 uint32
+}
+
+// newSnow3g initializes the generator with key words k0..k3 and IV words
+// iv0..iv3
+func newSnow3g(k, iv [4]uint32) *snow3g {
+	g := &snow3g{}
+	one := uint32(0xffffffff)
+	g.s = [16]uint32{
+		k[0] ^ one, k[1] ^ one, k[2] ^ one, k[3] ^ one,
+		k[0], k[1], k[2], k[3],
+		k[0] ^ one, k[1] ^ one ^ iv[3], k[2] ^ one ^ iv[2], k[3] ^ one,
+		k[0] ^ iv[1], k[1], k[2], k[3] ^ iv[0],
+	}
+	for i := 0; i < 32; i++ {
+		g.clockLfsr(g.clockFsm())
+	}
+	g.clockFsm()
+	g.clockLfsr(0)
+	return g
+}
+
+func (g *snow3g) clockFsm() uint32 {
+	f := (g.s[15] + g.r1) ^ g.r2
+	r := g.r2 + (g.r3 ^ g.s[5])
+	g.r3 = snowS(g.r2, &snowSQ, 0x69)
+	g.r2 = snowS(g.r1, &snowSR, 0x1b)
+	g.r1 = r
+	return f
+}
+
+// f is the FSM output in initialization mode, zero in keystream mode
+func (g *snow3g) clockLfsr(f uint32) {
+	s0, s11 := g.s[0], g.s[11]
+	v := (s0 << 8) ^ snowMul[s0>>24] ^ g.s[2] ^ (s11 >> 8) ^ snowDiv[s11&0xff] ^ f
+	copy(g.s[:15], g.s[1:])
+	g.s[15] = v
+}
+
+func (g *snow3g) next() uint32 {
+	z := g.clockFsm() ^ g.s[0]
+	g.clockLfsr(0)
+	return z
+}
+
+func (g *snow3g) keystream(n int) []uint32 {
+	z := make([]uint32, n)
+	for i := range z {
+		z[i] = g.next()
+	}
+	return z
+}
+
+// key words: k3 is the first 32 bits of the key
+func snowKey(key []byte) (k [4]uint32) {
+	for i := 0; i < 4; i++ {
+		k[3-i] = binary.BigEndian.Uint32(key[4*i:])
+	}
+	return
+}
+
+// NEA1 ciphers (or deciphers) the first length bits of data with the SNOW 3G
+// keystream
+func NEA1(key []byte, count uint32, bearer, direction uint8, data []byte, length uint32) (out []byte, err error) {
+	if out, err = nasAlgInput(key, data, length); err != nil {
+		return
+	}
+	bd := uint32(bearer&0x1f)<<27 | uint32(direction&0x01)<<26
+	g := newSnow3g(snowKey(key), [4]uint32{bd, count, bd, count})
+	var z [4]byte
+	for i := 0; i < len(out); i += 4 {
+		binary.BigEndian.PutUint32(z[:], g.next())
+		for j := 0; j < 4 && i+j < len(out); j++ {
+			out[i+j] ^= z[j]
+		}
+	}
+	maskTail(out, length)
+	return
+}
+
+// NIA1 computes the 32 bit MAC-I/NAS-MAC over the first length bits of data
+// (UIA2 with FRESH = BEARER || 0...0)
+func NIA1(key []byte, count uint32, bearer, direction uint8, data []byte, length uint32) (mac []byte, err error) {
+	var msg []byte
+	if msg, err = nasAlgInput(key, data, length); err != nil {
+		return
+	}
+	maskTail(msg, length)
+	fresh := uint32(bearer&0x1f) << 27
+	dir := uint32(direction & 0x01)
+	g := newSnow3g(snowKey(key), [4]uint32{fresh ^ dir<<15, count ^ dir<<31, fresh, count})
+	z := g.keystream(5)
+	p := uint64(z[0])<<32 | uint64(z[1])
+	q := uint64(z[2])<<32 | uint64(z[3])
+
+	//message blocks of 64 bits padded with zeros
+	var eval uint64
+	blocks := int((length + 63) / 64)
+	padded := make([]byte, 8*blocks)
+	copy(padded, msg)
+	for i := 0; i < blocks; i++ {
+		eval = mul64(eval^binary.BigEndian.Uint64(padded[8*i:]), p, 0x1b)
+	}
+	eval ^= uint64(length)
+	eval = mul64(eval, q, 0x1b)
+	mac = binary.BigEndian.AppendUint32(nil, uint32(eval>>32)^z[4])
+	return
+}
+
+// multiplication in GF(2^64) with the reduction constant c
+func mul64(v, p, c uint64) (r uint64) {
+	for ; p != 0; p >>= 1 {
+		if p&1 != 0 {
+			r ^= v
+		}
+		if v&(1<<63) != 0 {
+			v = v<<1 ^ c
+		} else {
+			v <<= 1
+		}
+	}
+	return
+}
+
+// Snow3gKeystream generates n keystream words from the key and IV words as
+// given in the SNOW 3G specification (k0..k3, iv0..iv3)
+func Snow3gKeystream(k, iv [4]uint32, n int) ([]uint32, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("Wrong keystream length")
+	}
+	return newSnow3g(k, iv).keystream(n), nil
+}
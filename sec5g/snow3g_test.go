@@ -0,0 +1,101 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSnow3g(t *testing.T) {
+	//SNOW 3G specification test sets 1 and 2
+	table := []struct {
+		K, IV [4]uint32
+		Z     []uint32
+	}{
+		{
+			K:  [4]uint32{0x2bd6459f, 0x82c5b300, 0x952c4910, 0x4881ff48},
+			IV: [4]uint32{0xea024714, 0xad5c4d84, 0xdf1f9b25, 0x1c0bf45f},
+			Z:  []uint32{0xabee9704, 0x7ac31373},
+		},
+		{
+			K:  [4]uint32{0x8ce33e2c, 0xc3c0b5fc, 0x1f3de8a6, 0xdc66b1f3},
+			IV: [4]uint32{0xd3c5d592, 0x327fb11c, 0xde551988, 0xceb2f9b7},
+			Z:  []uint32{0xeff8a342, 0xf751480f},
+		},
+	}
+	for i, tc := range table {
+		z, _ := Snow3gKeystream(tc.K, tc.IV, len(tc.Z))
+		for j := range z {
+			if z[j] != tc.Z[j] {
+				t.Errorf("[%d] wrong keystream word %d: %08x", i, j, z[j])
+			}
+		}
+	}
+}
+
+func TestNEA1(t *testing.T) {
+	//TS 33.401 C.3
+	table := []NasAlgTestCase{
+		{
+			Key:       "d3c5d592327fb11c4035c6680af8c6d1",
+			Count:     0x398a59b4,
+			Bearer:    0x15,
+			Direction: 1,
+			Length:    253,
+			Input:     "981ba6824c1bfb1ab485472029b71d808ce33e2cc3c0b5fc1f3de8a6dc66b1f0",
+			Output:    "5d5bfe75eb04f68ce0a12377ea00b37d47c6a0ba06309155086a859c4341b378",
+		},
+	}
+	for i, tc := range table {
+		key, _ := hex.DecodeString(tc.Key)
+		in, _ := hex.DecodeString(tc.Input)
+		out, err := NEA1(key, tc.Count, tc.Bearer, tc.Direction, in, tc.Length)
+		if err != nil {
+			t.Fatalf("[%d] NEA1 failed: %+v", i, err)
+		}
+		if hex.EncodeToString(out) != tc.Output {
+			t.Errorf("[%d] wrong ciphertext %x", i, out)
+		}
+		plain, _ := NEA1(key, tc.Count, tc.Bearer, tc.Direction, out, tc.Length)
+		maskTail(in, tc.Length)
+		if !bytes.Equal(plain, in) {
+			t.Errorf("[%d] wrong deciphered text %x", i, plain)
+		}
+	}
+}
+
+func TestNIA1(t *testing.T) {
+	if r := mul64(1<<63, 2, 0x1b); r != 0x1b {
+		t.Errorf("wrong GF(2^64) reduction %x", r)
+	}
+	if mul64(0x0123456789abcdef, 0xfedcba9876543210, 0x1b) != mul64(0xfedcba9876543210, 0x0123456789abcdef, 0x1b) {
+		t.Errorf("GF(2^64) multiplication must be commutative")
+	}
+
+	key, _ := hex.DecodeString("2bd6459f82c5b300952c49104881ff48")
+	msg, _ := hex.DecodeString("3332346263393840")
+	mac, err := NIA1(key, 0x38a6f056, 0x18, 0, msg, 58)
+	if err != nil || len(mac) != 4 {
+		t.Fatalf("NIA1 failed: %v", err)
+	}
+	//bits after LENGTH are ignored
+	msg[7] ^= 0x3f
+	if mac2, _ := NIA1(key, 0x38a6f056, 0x18, 0, msg, 58); !bytes.Equal(mac, mac2) {
+		t.Errorf("bits after LENGTH must be ignored")
+	}
+	for _, v := range [][]byte{
+		mustNIA1(key, 0x38a6f056, 0x18, 1, msg, 58),
+		mustNIA1(key, 0x38a6f056, 0x19, 0, msg, 58),
+		mustNIA1(key, 0x38a6f057, 0x18, 0, msg, 58),
+		mustNIA1(key, 0x38a6f056, 0x18, 0, msg, 57),
+	} {
+		if bytes.Equal(mac, v) {
+			t.Errorf("MAC must depend on all inputs")
+		}
+	}
+}
+
+func mustNIA1(key []byte, count uint32, bearer, direction uint8, data []byte, length uint32) []byte {
+	mac, _ := NIA1(key, count, bearer, direction, data, length)
+	return mac
+}
@@ -0,0 +1,206 @@
+package sec5g
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// file-backed soft-HSM: keys are wrapped with AES-GCM under a key encryption
+// key (KEK) and only unwrapped for the time of an operation. The file has
+// one line per long-term key: handle, kind and hex encoded nonce || wrapped
+// key. Session keys are wrapped the same way but only kept in memory.
+
+type softHsmStorage struct {
+	path  string
+	aead  cipher.AEAD
+	keys  map[KeyHandle]softHsmEntry
+	mutex sync.RWMutex
+}
+
+type softHsmEntry struct {
+	kind    uint8
+	wrapped []byte //nonce || ciphertext
+	session bool   //not persisted
+}
+
+// OpenSoftHsm opens (or creates) a soft-HSM file with a 16, 24 or 32 bytes
+// KEK. All stored keys are checked against the KEK.
+func OpenSoftHsm(path string, kek []byte) (p KeyProvider, err error) {
+	var block cipher.Block
+	if block, err = aes.NewCipher(kek); err != nil {
+		return
+	}
+	s := &softHsmStorage{
+		path: path,
+		keys: make(map[KeyHandle]softHsmEntry),
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return
+	}
+	if err = s.load(); err != nil {
+		return
+	}
+	p = &keyProvider{storage: s}
+	return
+}
+
+func (s *softHsmStorage) load() error {
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("Invalid soft-HSM entry at line %d", line)
+		}
+		h := KeyHandle(fields[0])
+		kind, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil {
+			return fmt.Errorf("Invalid key type at line %d", line)
+		}
+		entry := softHsmEntry{kind: uint8(kind)}
+		if entry.wrapped, err = hex.DecodeString(fields[2]); err != nil {
+			return fmt.Errorf("Invalid wrapped key at line %d", line)
+		}
+		plain, err := s.unwrap(h, entry)
+		if err != nil {
+			return fmt.Errorf("Failed to unwrap key %s: %s", h, err.Error())
+		}
+		zeroize(plain)
+		s.keys[h] = entry
+	}
+	return nil
+}
+
+// write the long-term entries to a temporary file then replace the soft-HSM
+// file. The data is synced before the rename and the directory after it, so
+// that a crash leaves either the old or the new file.
+func (s *softHsmStorage) save() error {
+	var buf bytes.Buffer
+	for h, entry := range s.keys {
+		if !entry.session {
+			fmt.Fprintf(&buf, "%s %d %x\n", h, entry.kind, entry.wrapped)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := writeFileSync(tmp, buf.Bytes()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(s.path))
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	d.Close()
+	return err
+}
+
+// the handle and kind are authenticated with the key
+func softHsmAad(h KeyHandle, kind uint8) []byte {
+	return append([]byte(h), kind)
+}
+
+func (s *softHsmStorage) unwrap(h KeyHandle, entry softHsmEntry) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(entry.wrapped) < n {
+		return nil, fmt.Errorf("Wrapped key is too short")
+	}
+	return s.aead.Open(nil, entry.wrapped[:n], entry.wrapped[n:], softHsmAad(h, entry.kind))
+}
+
+func (s *softHsmStorage) put(h KeyHandle, kind uint8, plain []byte, session bool) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	entry := softHsmEntry{
+		kind:    kind,
+		wrapped: s.aead.Seal(nonce, nonce, plain, softHsmAad(h, kind)),
+		session: session,
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[h] = entry
+	if session {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		delete(s.keys, h)
+		return err
+	}
+	return nil
+}
+
+func (s *softHsmStorage) open(h KeyHandle) (kind uint8, plain []byte, err error) {
+	s.mutex.RLock()
+	entry, ok := s.keys[h]
+	s.mutex.RUnlock()
+	if !ok {
+		err = fmt.Errorf("Unknown key %s", h)
+		return
+	}
+	if plain, err = s.unwrap(h, entry); err != nil {
+		return
+	}
+	kind = entry.kind
+	return
+}
+
+func (s *softHsmStorage) remove(h KeyHandle) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.keys[h]
+	if !ok {
+		return fmt.Errorf("Unknown key %s", h)
+	}
+	delete(s.keys, h)
+	if entry.session {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		s.keys[h] = entry
+		return err
+	}
+	return nil
+}
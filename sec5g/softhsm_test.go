@@ -0,0 +1,123 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSoftHsmFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	kek := bytes.Repeat([]byte{0xa5}, 32)
+	secret, _ := hex.DecodeString("00112233445566778899aabbccddeeff0123456789abcdef0123456789abcdef")
+
+	p, err := OpenSoftHsm(path, kek)
+	if err != nil {
+		t.Fatalf("OpenSoftHsm failed: %+v", err)
+	}
+	imported := append([]byte{}, secret...)
+	h, err := p.ImportKey(imported)
+	if err != nil {
+		t.Fatalf("ImportKey failed: %+v", err)
+	}
+	if !bytes.Equal(imported, make([]byte, len(secret))) {
+		t.Errorf("imported key is not zeroized")
+	}
+
+	content, _ := os.ReadFile(path)
+	if bytes.Contains(content, secret) || bytes.Contains(content, []byte(hex.EncodeToString(secret))) {
+		t.Errorf("key is stored in clear")
+	}
+
+	//keys survive a reopen
+	p, err = OpenSoftHsm(path, kek)
+	if err != nil {
+		t.Fatalf("reopen failed: %+v", err)
+	}
+	if !bytes.Equal(providerKey(p, h), secret) {
+		t.Errorf("wrong key after reopen")
+	}
+
+	if _, err = OpenSoftHsm(path, bytes.Repeat([]byte{0x00}, 32)); err == nil {
+		t.Errorf("wrong KEK must be rejected")
+	}
+	if _, err = OpenSoftHsm(path, kek[:15]); err == nil {
+		t.Errorf("wrong KEK size must be rejected")
+	}
+
+	//a wrapped key moved to another handle does not unwrap
+	other, _ := p.ImportKey(append([]byte{}, secret...))
+	content, _ = os.ReadFile(path)
+	swapped := bytes.ReplaceAll(content, []byte(h), []byte("x"))
+	swapped = bytes.ReplaceAll(swapped, []byte(other), []byte(h))
+	swapped = bytes.ReplaceAll(swapped, []byte("x"), []byte(other))
+	os.WriteFile(path, swapped, 0600)
+	if _, err = OpenSoftHsm(path, kek); err == nil {
+		t.Errorf("swapped wrapped keys must be rejected")
+	}
+
+	os.WriteFile(path, []byte("broken\n"), 0600)
+	if _, err = OpenSoftHsm(path, kek); err == nil {
+		t.Errorf("broken file must be rejected")
+	}
+}
+
+func TestSoftHsmReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	kek := bytes.Repeat([]byte{0x3c}, 16)
+	p, err := OpenSoftHsm(path, kek)
+	if err != nil {
+		t.Fatalf("OpenSoftHsm failed: %+v", err)
+	}
+
+	var handles []KeyHandle
+	var derived []KeyHandle
+	for i := 0; i < 5; i++ {
+		h, err := p.ImportKey(bytes.Repeat([]byte{uint8(i + 1)}, 32))
+		if err != nil {
+			t.Fatalf("ImportKey failed: %+v", err)
+		}
+		handles = append(handles, h)
+		d, err := p.DeriveKey(h, FC_NH, []byte{uint8(i)})
+		if err != nil {
+			t.Fatalf("DeriveKey failed: %+v", err)
+		}
+		derived = append(derived, d)
+	}
+	if err = p.Delete(handles[2]); err != nil {
+		t.Fatalf("Delete failed: %+v", err)
+	}
+	if err = p.Delete(derived[3]); err != nil {
+		t.Fatalf("Delete failed: %+v", err)
+	}
+	if _, err = os.Stat(path + ".tmp"); err == nil {
+		t.Errorf("temporary file is left")
+	}
+
+	//long-term keys survive, session keys are gone
+	p, err = OpenSoftHsm(path, kek)
+	if err != nil {
+		t.Fatalf("reopen failed: %+v", err)
+	}
+	for i, h := range handles {
+		plain := providerKey(p, h)
+		if i == 2 {
+			if plain != nil {
+				t.Errorf("deleted key %d is back", i)
+			}
+		} else if !bytes.Equal(plain, bytes.Repeat([]byte{uint8(i + 1)}, 32)) {
+			t.Errorf("wrong key %d after reopen", i)
+		}
+	}
+	for i, d := range derived {
+		if _, err = p.DeriveKey(d, FC_NH, []byte{0}); err == nil {
+			t.Errorf("session key %d must not be persisted", i)
+		}
+	}
+	content, _ := os.ReadFile(path)
+	if lines := bytes.Count(content, []byte("\n")); lines != 4 {
+		t.Errorf("wrong number of stored keys %d", lines)
+	}
+}
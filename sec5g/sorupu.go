@@ -0,0 +1,203 @@
+package sec5g
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Steering of Roaming and UE Parameters Update protection with KAUSF
+// (TS 33.501 6.14, 6.15, A.17 and A.19)
+
+// P0 of the UE acknowledgement MACs
+const (
+	SOR_ACKNOWLEDGEMENT uint8 = 0x01
+	UPU_ACKNOWLEDGEMENT uint8 = 0x01
+)
+
+var (
+	ErrCounterWrap = errors.New("Counter would wrap around, a new KAUSF is needed")
+	ErrMac         = errors.New("MAC verification failed")
+	ErrReplay      = errors.New("Counter has already been used")
+)
+
+func counterParam(counter uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, counter)
+}
+
+// the MACs are the 128 least significant bits of the KDF output
+func macIausf(kausf []byte, FC string, param ...[]byte) (mac []byte, err error) {
+	if len(kausf) != 32 {
+		err = fmt.Errorf("Wrong KAUSF size")
+		return
+	}
+	var sum []byte
+	if sum, err = KDF(kausf, FC, param...); err == nil {
+		mac = sum[16:]
+	}
+	return
+}
+
+// SorMacIausf computes SoR-MAC-IAUSF over the SoR header, CounterSoR and the
+// steering information list
+func SorMacIausf(kausf []byte, header uint8, counter uint16, steering []byte) ([]byte, error) {
+	return macIausf(kausf, FC_FOR_SOR_MAC_IAUSF, []byte{header}, counterParam(counter), steering)
+}
+
+// SorMacIue computes SoR-MAC-IUE (SoR-XMAC-IUE on the AUSF side)
+func SorMacIue(kausf []byte, counter uint16) ([]byte, error) {
+	return macIausf(kausf, FC_FOR_SOR_MAC_IUE, []byte{SOR_ACKNOWLEDGEMENT}, counterParam(counter))
+}
+
+// UpuMacIausf computes UPU-MAC-IAUSF over the UE parameters update data and
+// CounterUPU
+func UpuMacIausf(kausf []byte, data []byte, counter uint16) ([]byte, error) {
+	return macIausf(kausf, FC_FOR_UPU_MAC_IAUSF, data, counterParam(counter))
+}
+
+// UpuMacIue computes UPU-MAC-IUE (UPU-XMAC-IUE on the AUSF side)
+func UpuMacIue(kausf []byte, counter uint16) ([]byte, error) {
+	return macIausf(kausf, FC_FOR_UPU_MAC_IUE, []byte{UPU_ACKNOWLEDGEMENT}, counterParam(counter))
+}
+
+// KausfCounters keeps CounterSoR and CounterUPU of a KAUSF on the AUSF side.
+// Both start at 1 when KAUSF is derived and are incremented for each
+// protected payload; they never wrap around.
+type KausfCounters struct {
+	kausf []byte
+	sor   uint32 //next counter to use
+	upu   uint32
+	mutex sync.Mutex
+}
+
+func NewKausfCounters(kausf []byte) (c *KausfCounters, err error) {
+	if len(kausf) != 32 {
+		err = fmt.Errorf("Wrong KAUSF size")
+		return
+	}
+	c = &KausfCounters{
+		kausf: append([]byte{}, kausf...),
+		sor:   1,
+		upu:   1,
+	}
+	return
+}
+
+func nextCounter(counter *uint32) (uint16, error) {
+	if *counter > 0xffff {
+		return 0, ErrCounterWrap
+	}
+	v := uint16(*counter)
+	*counter++
+	return v, nil
+}
+
+// ProtectSor takes the next CounterSoR and computes SoR-MAC-IAUSF
+func (c *KausfCounters) ProtectSor(header uint8, steering []byte) (mac []byte, counter uint16, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if counter, err = nextCounter(&c.sor); err != nil {
+		return
+	}
+	mac, err = SorMacIausf(c.kausf, header, counter, steering)
+	return
+}
+
+// VerifySorAck checks the SoR-MAC-IUE of the UE acknowledgement against
+// SoR-XMAC-IUE
+func (c *KausfCounters) VerifySorAck(counter uint16, mac []byte) error {
+	xmac, err := SorMacIue(c.kausf, counter)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(xmac, mac) {
+		return ErrMac
+	}
+	return nil
+}
+
+// ProtectUpu takes the next CounterUPU and computes UPU-MAC-IAUSF
+func (c *KausfCounters) ProtectUpu(data []byte) (mac []byte, counter uint16, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if counter, err = nextCounter(&c.upu); err != nil {
+		return
+	}
+	mac, err = UpuMacIausf(c.kausf, data, counter)
+	return
+}
+
+// VerifyUpuAck checks the UPU-MAC-IUE of the UE acknowledgement against
+// UPU-XMAC-IUE
+func (c *KausfCounters) VerifyUpuAck(counter uint16, mac []byte) error {
+	xmac, err := UpuMacIue(c.kausf, counter)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(xmac, mac) {
+		return ErrMac
+	}
+	return nil
+}
+
+// UeKausfCounters keeps the last accepted CounterSoR and CounterUPU on the
+// UE side; both are reset to 0 when KAUSF is derived
+type UeKausfCounters struct {
+	kausf []byte
+	sor   uint16
+	upu   uint16
+	mutex sync.Mutex
+}
+
+func NewUeKausfCounters(kausf []byte) (c *UeKausfCounters, err error) {
+	if len(kausf) != 32 {
+		err = fmt.Errorf("Wrong KAUSF size")
+		return
+	}
+	c = &UeKausfCounters{
+		kausf: append([]byte{}, kausf...),
+	}
+	return
+}
+
+// VerifySor checks a protected SoR payload and returns the SoR-MAC-IUE of
+// the acknowledgement. Counters not greater than the last accepted one are
+// rejected.
+func (c *UeKausfCounters) VerifySor(header uint8, counter uint16, steering, mac []byte) (ack []byte, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if counter <= c.sor {
+		return nil, ErrReplay
+	}
+	var xmac []byte
+	if xmac, err = SorMacIausf(c.kausf, header, counter, steering); err != nil {
+		return
+	}
+	if !hmac.Equal(xmac, mac) {
+		return nil, ErrMac
+	}
+	c.sor = counter
+	return SorMacIue(c.kausf, counter)
+}
+
+// VerifyUpu checks a protected UE parameters update and returns the
+// UPU-MAC-IUE of the acknowledgement. Counters not greater than the last
+// accepted one are rejected.
+func (c *UeKausfCounters) VerifyUpu(data []byte, counter uint16, mac []byte) (ack []byte, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if counter <= c.upu {
+		return nil, ErrReplay
+	}
+	var xmac []byte
+	if xmac, err = UpuMacIausf(c.kausf, data, counter); err != nil {
+		return
+	}
+	if !hmac.Equal(xmac, mac) {
+		return nil, ErrMac
+	}
+	c.upu = counter
+	return UpuMacIue(c.kausf, counter)
+}
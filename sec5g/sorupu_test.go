@@ -0,0 +1,104 @@
+package sec5g
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestSorUpuMacs(t *testing.T) {
+	kausf, _ := hex.DecodeString("0b7e2f4c71a9d3e85c6a0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a")
+	steering := []byte{0x02, 0xf8, 0x39, 0x80, 0x00}
+
+	//77 || 09 || 0001 || 0102 || 0002 || steering || 0005
+	mac, _ := SorMacIausf(kausf, 0x09, 0x0102, steering)
+	if hex.EncodeToString(mac) != "11c02cabefbd97466d87d5eb9313cd7e" {
+		t.Errorf("wrong SoR-MAC-IAUSF %x", mac)
+	}
+	//78 || 01 || 0001 || 0102 || 0002
+	mac, _ = SorMacIue(kausf, 0x0102)
+	if hex.EncodeToString(mac) != "c4374621e2473284097c22d45bed3130" {
+		t.Errorf("wrong SoR-MAC-IUE %x", mac)
+	}
+	//7b || data || 0005 || 0003 || 0002
+	mac, _ = UpuMacIausf(kausf, steering, 0x0003)
+	if hex.EncodeToString(mac) != "f7852820da5aa3d2bd0706af764d2fe2" {
+		t.Errorf("wrong UPU-MAC-IAUSF %x", mac)
+	}
+	//7c || 01 || 0001 || 0003 || 0002
+	mac, _ = UpuMacIue(kausf, 0x0003)
+	if hex.EncodeToString(mac) != "a9ec7025e1f1587fb27cf5ed5955b8f1" {
+		t.Errorf("wrong UPU-MAC-IUE %x", mac)
+	}
+
+	short := kausf[:16]
+	if _, err := SorMacIausf(short, 0x09, 0x0102, steering); err == nil {
+		t.Errorf("short KAUSF must be rejected")
+	}
+	if _, err := SorMacIue(short, 0x0102); err == nil {
+		t.Errorf("short KAUSF must be rejected")
+	}
+	if _, err := UpuMacIausf(short, steering, 0x0003); err == nil {
+		t.Errorf("short KAUSF must be rejected")
+	}
+	if _, err := UpuMacIue(short, 0x0003); err == nil {
+		t.Errorf("short KAUSF must be rejected")
+	}
+}
+
+func TestSorUpuCounters(t *testing.T) {
+	kausf, _ := hex.DecodeString("0b7e2f4c71a9d3e85c6a0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a")
+	steering := []byte{0x02, 0xf8, 0x39, 0x80, 0x00}
+	ausf, err := NewKausfCounters(kausf)
+	if err != nil {
+		t.Fatalf("NewKausfCounters failed: %+v", err)
+	}
+	ue, _ := NewUeKausfCounters(kausf)
+
+	for i := 1; i <= 3; i++ {
+		mac, counter, err := ausf.ProtectSor(0x09, steering)
+		if err != nil || counter != uint16(i) {
+			t.Fatalf("ProtectSor failed: %d %+v", counter, err)
+		}
+		ack, err := ue.VerifySor(0x09, counter, steering, mac)
+		if err != nil {
+			t.Fatalf("VerifySor failed: %+v", err)
+		}
+		if err = ausf.VerifySorAck(counter, ack); err != nil {
+			t.Errorf("VerifySorAck failed: %+v", err)
+		}
+		if _, err = ue.VerifySor(0x09, counter, steering, mac); err != ErrReplay {
+			t.Errorf("replayed SoR must be rejected: %+v", err)
+		}
+	}
+	mac, counter, _ := ausf.ProtectSor(0x09, steering)
+	if _, err = ue.VerifySor(0x08, counter, steering, mac); err != ErrMac {
+		t.Errorf("modified SoR header must be rejected: %+v", err)
+	}
+	if err = ausf.VerifySorAck(counter, mac); err != ErrMac {
+		t.Errorf("wrong acknowledgement must be rejected: %+v", err)
+	}
+
+	data := []byte{0x01, 0x02}
+	mac, counter, _ = ausf.ProtectUpu(data)
+	if counter != 1 {
+		t.Errorf("CounterUPU must start at 1: %d", counter)
+	}
+	ack, err := ue.VerifyUpu(data, counter, mac)
+	if err != nil || ausf.VerifyUpuAck(counter, ack) != nil {
+		t.Errorf("UPU failed: %+v", err)
+	}
+	if _, err = ue.VerifyUpu(data, counter, mac); err != ErrReplay {
+		t.Errorf("replayed UPU must be rejected: %+v", err)
+	}
+
+	ausf.upu = 0xffff
+	if _, counter, err = ausf.ProtectUpu(data); err != nil || counter != 0xffff {
+		t.Errorf("last CounterUPU must be usable: %d %+v", counter, err)
+	}
+	if _, _, err = ausf.ProtectUpu(data); err != ErrCounterWrap {
+		t.Errorf("CounterUPU must not wrap around: %+v", err)
+	}
+	if _, err = NewKausfCounters(kausf[:16]); err == nil {
+		t.Errorf("short KAUSF must be rejected")
+	}
+}
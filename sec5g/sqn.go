@@ -0,0 +1,173 @@
+package sec5g
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// SQN management scheme of TS 33.102 Annex C: a SQN is SEQ || IND where IND
+// is the lowest IndBits bits. The home network keeps a single SEQ counter and
+// cycles IND over the array size; the USIM keeps one SEQ per IND.
+
+const (
+	sqnBits        = 48
+	sqnMask        = uint64(1)<<sqnBits - 1
+	maxIndBits     = 10
+	DefaultIndBits = 5       //a = 32
+	DefaultDelta   = 1 << 28 //recommended wrap around limit
+)
+
+type SqnManager struct {
+	indBits uint8
+	delta   uint64   //limit of SEQ - SEQ_MS, zero to disable
+	limit   uint64   //age limit L of SEQ_MS - SEQ, zero to disable
+	sqnHe   uint64   //last SQN generated by the home network
+	sqnMs   uint64   //highest accepted SQN at the USIM
+	seqMs   []uint64 //accepted SEQ per IND at the USIM
+	mutex   sync.Mutex
+}
+
+func NewSqnManager(indBits uint8, delta, limit uint64) (m *SqnManager, err error) {
+	if indBits > maxIndBits {
+		err = fmt.Errorf("IND length %d is too long", indBits)
+		return
+	}
+	m = &SqnManager{
+		indBits: indBits,
+		delta:   delta,
+		limit:   limit,
+		seqMs:   make([]uint64, 1<<indBits),
+	}
+	return
+}
+
+func SqnFromBytes(b []uint8) (sqn uint64) {
+	var buf [8]uint8
+	copy(buf[2:], b)
+	return binary.BigEndian.Uint64(buf[:]) & sqnMask
+}
+
+func SqnToBytes(sqn uint64) (b [6]uint8) {
+	var buf [8]uint8
+	binary.BigEndian.PutUint64(buf[:], sqn&sqnMask)
+	copy(b[:], buf[2:])
+	return
+}
+
+func (m *SqnManager) seq(sqn uint64) uint64 {
+	return sqn >> m.indBits
+}
+
+func (m *SqnManager) ind(sqn uint64) uint64 {
+	return sqn & (uint64(1)<<m.indBits - 1)
+}
+
+// Next generates the SQN of a new authentication vector: SEQ is incremented
+// and IND moves to the next array slot (TS 33.102 C.3.2)
+func (m *SqnManager) Next() [6]uint8 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	seq := (m.seq(m.sqnHe) + 1) & (sqnMask >> m.indBits)
+	ind := (m.ind(m.sqnHe) + 1) & (uint64(1)<<m.indBits - 1)
+	m.sqnHe = seq<<m.indBits | ind
+	return SqnToBytes(m.sqnHe)
+}
+
+// Resync sets the home network counter from the SQN_MS recovered from an AUTS
+// (e.g. the output of ValidateAuts) so that the next SQN is accepted (TS
+// 33.102 C.3.4)
+func (m *SqnManager) Resync(sqnms [6]uint8) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sqn := SqnFromBytes(sqnms[:])
+	m.sqnHe = m.seq(sqn)<<m.indBits | m.ind(m.sqnHe)
+}
+
+// SqnHe returns the last SQN generated by the home network
+func (m *SqnManager) SqnHe() [6]uint8 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return SqnToBytes(m.sqnHe)
+}
+
+// Check tells if a received SQN would be accepted by the USIM (TS 33.102
+// C.2.2) without updating the state
+func (m *SqnManager) Check(sqn [6]uint8) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.check(SqnFromBytes(sqn[:]))
+}
+
+func (m *SqnManager) check(sqn uint64) bool {
+	seq := m.seq(sqn)
+	highest := m.seq(m.sqnMs)
+	if seq <= m.seqMs[m.ind(sqn)] {
+		return false
+	}
+	if m.delta > 0 && seq > highest && seq-highest > m.delta {
+		return false
+	}
+	if m.limit > 0 && highest > seq && highest-seq > m.limit {
+		return false
+	}
+	return true
+}
+
+// Verify checks a received SQN and records it when accepted. It can be used
+// as the SqnChecker of VerifyAutn.
+func (m *SqnManager) Verify(sqn [6]uint8) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v := SqnFromBytes(sqn[:])
+	if !m.check(v) {
+		return false
+	}
+	m.seqMs[m.ind(v)] = m.seq(v)
+	if m.seq(v) > m.seq(m.sqnMs) {
+		m.sqnMs = v
+	}
+	return true
+}
+
+// SqnMs returns the highest accepted SQN, which is sent in AUTS on a
+// synchronisation failure
+func (m *SqnManager) SqnMs() [6]uint8 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return SqnToBytes(m.sqnMs)
+}
+
+// MarshalBinary encodes the manager as IndBits(1) || Delta(8) || Limit(8) ||
+// SQN_HE(6) || SQN_MS(6) || SEQ_MS array (6 each)
+func (m *SqnManager) MarshalBinary() ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	buf := make([]byte, 0, 29+6*len(m.seqMs))
+	buf = append(buf, m.indBits)
+	buf = binary.BigEndian.AppendUint64(buf, m.delta)
+	buf = binary.BigEndian.AppendUint64(buf, m.limit)
+	for _, v := range append([]uint64{m.sqnHe, m.sqnMs}, m.seqMs...) {
+		b := SqnToBytes(v)
+		buf = append(buf, b[:]...)
+	}
+	return buf, nil
+}
+
+func (m *SqnManager) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 29 || buf[0] > maxIndBits || len(buf) != 29+6*(1<<buf[0]) {
+		return fmt.Errorf("Wrong SQN manager encoding")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.indBits = buf[0]
+	m.delta = binary.BigEndian.Uint64(buf[1:])
+	m.limit = binary.BigEndian.Uint64(buf[9:])
+	m.sqnHe = SqnFromBytes(buf[17:23])
+	m.sqnMs = SqnFromBytes(buf[23:29])
+	m.seqMs = make([]uint64, 1<<m.indBits)
+	for i := range m.seqMs {
+		m.seqMs[i] = SqnFromBytes(buf[29+6*i : 35+6*i])
+	}
+	return nil
+}
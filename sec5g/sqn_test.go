@@ -0,0 +1,70 @@
+package sec5g
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSqnManager(t *testing.T) {
+	he, _ := NewSqnManager(DefaultIndBits, DefaultDelta, 0)
+	ms, _ := NewSqnManager(DefaultIndBits, DefaultDelta, 0)
+
+	var sqns [][6]uint8
+	for i := 0; i < 40; i++ {
+		sqns = append(sqns, he.Next())
+	}
+	//IND cycles over the 32 slots while SEQ increases
+	if sqns[0] != SqnToBytes(1<<5|1) || sqns[31] != SqnToBytes(32<<5|0) || sqns[32] != SqnToBytes(33<<5|1) {
+		t.Errorf("wrong generated SQN: %x %x %x", sqns[0], sqns[31], sqns[32])
+	}
+
+	//vectors used out of order are accepted once
+	for _, i := range []int{3, 1, 2, 39} {
+		if !ms.Verify(sqns[i]) {
+			t.Errorf("SQN %x must be accepted", sqns[i])
+		}
+	}
+	if ms.Verify(sqns[2]) {
+		t.Errorf("replayed SQN must be rejected")
+	}
+	//same IND with an older SEQ
+	if ms.Verify(sqns[7]) {
+		t.Errorf("SQN older than its IND slot must be rejected")
+	}
+	if ms.SqnMs() != sqns[39] {
+		t.Errorf("wrong highest SQN %x", ms.SqnMs())
+	}
+
+	//wrap around protection
+	far := SqnToBytes(SqnFromBytes(sqns[39][:]) + (DefaultDelta+1)<<5)
+	if ms.Check(far) {
+		t.Errorf("SQN beyond delta must be rejected")
+	}
+
+	//re-synchronisation from the USIM counter
+	he2, _ := NewSqnManager(DefaultIndBits, DefaultDelta, 0)
+	he2.Resync(ms.SqnMs())
+	if next := he2.Next(); !ms.Check(next) {
+		t.Errorf("SQN after resync must be accepted: %x", next)
+	}
+
+	//serialization
+	buf, _ := ms.MarshalBinary()
+	var restored SqnManager
+	if err := restored.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %+v", err)
+	}
+	buf2, _ := restored.MarshalBinary()
+	if !bytes.Equal(buf, buf2) {
+		t.Errorf("serialization mismatch")
+	}
+	if restored.Verify(sqns[3]) {
+		t.Errorf("restored manager must remember accepted SQN")
+	}
+	if err := restored.UnmarshalBinary(buf[:40]); err == nil {
+		t.Errorf("truncated encoding must be rejected")
+	}
+	if _, err := NewSqnManager(11, 0, 0); err == nil {
+		t.Errorf("too long IND must be rejected")
+	}
+}
@@ -0,0 +1,281 @@
+package sec5g
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// TUAK algorithm set (TS 35.231)
+
+const tuakAlgoName = "TUAK1.0"
+
+// output sizes (in bytes) and Keccak iterations of a TUAK instance
+type TuakParams struct {
+	ResLen     int // 4, 8, 16 or 32
+	MacLen     int // 8, 16 or 32
+	CkLen      int // 16 or 32
+	IkLen      int // 16 or 32
+	Iterations int // number of Keccak-f permutations, at least 1
+}
+
+// 64 bit RES/MAC, 128 bit CK/IK and a single Keccak iteration
+var defaultTuakParams = TuakParams{
+	ResLen:     8,
+	MacLen:     8,
+	CkLen:      16,
+	IkLen:      16,
+	Iterations: 1,
+}
+
+// DefaultTuakParams returns a copy of the parameters used by NewTuak
+func DefaultTuakParams() TuakParams {
+	return defaultTuakParams
+}
+
+func (p *TuakParams) validate() error {
+	switch p.ResLen {
+	case 4, 8, 16, 32:
+	default:
+		return fmt.Errorf("Wrong RES length %d", p.ResLen)
+	}
+	switch p.MacLen {
+	case 8, 16, 32:
+	default:
+		return fmt.Errorf("Wrong MAC length %d", p.MacLen)
+	}
+	if p.CkLen != 16 && p.CkLen != 32 {
+		return fmt.Errorf("Wrong CK length %d", p.CkLen)
+	}
+	if p.IkLen != 16 && p.IkLen != 32 {
+		return fmt.Errorf("Wrong IK length %d", p.IkLen)
+	}
+	if p.Iterations < 1 {
+		return fmt.Errorf("Wrong number of Keccak iterations %d", p.Iterations)
+	}
+	return nil
+}
+
+type Tuak struct {
+	k      []uint8
+	topc   [32]uint8
+	rand   [16]uint8
+	params TuakParams
+	reader io.Reader
+}
+
+func NewTuak(k []uint8, toptopc []uint8, istopc bool) (t *Tuak, err error) {
+	//default rand reader and parameters
+	t, err = NewTuakEx(k, rand.Reader, toptopc, istopc, nil)
+	return
+}
+
+// with customized rand reader and output sizes
+func NewTuakEx(k []uint8, r io.Reader, toptopc []uint8, istopc bool, params *TuakParams) (t *Tuak, err error) {
+	if (len(k) != 16 && len(k) != 32) || len(toptopc) != 32 {
+		err = fmt.Errorf("Wrong input size")
+		return
+	}
+	t = &Tuak{
+		k:      make([]uint8, len(k)),
+		reader: r,
+		params: defaultTuakParams,
+	}
+	if r == nil {
+		t.reader = rand.Reader
+	}
+	if params != nil {
+		if err = params.validate(); err != nil {
+			return nil, err
+		}
+		t.params = *params
+	}
+	copy(t.k, k)
+
+	//generate topc if it is needed
+	if !istopc {
+		var state [200]uint8
+		t.load(&state, toptopc, t.keyFlag(), nil)
+		pull(state[:], t.topc[:], 0)
+	} else {
+		copy(t.topc[:], toptopc)
+	}
+	t.Refresh()
+	return
+}
+
+// prepare a new random vector
+func (t *Tuak) Refresh() {
+	t.reader.Read(t.rand[:])
+}
+
+// set a new random vector
+func (t *Tuak) SetRand(r []uint8) error {
+	if len(r) != 16 {
+		return fmt.Errorf("Wrong rand size")
+	}
+	copy(t.rand[:], r)
+	return nil
+}
+
+func (t *Tuak) GetRand() []uint8 {
+	return t.rand[:]
+}
+
+// f1 and f1star
+func (t *Tuak) F1(sqn, amf []uint8) (maca []uint8, macs []uint8, err error) {
+	if len(sqn) != 6 || len(amf) != 2 {
+		err = fmt.Errorf("Wrong size input")
+		return
+	}
+	instance := t.keyFlag() | macLenFlag(t.params.MacLen)
+	maca = make([]uint8, t.params.MacLen)
+	out := t.operation(instance, sqn, amf)
+	pull(out[:], maca, 0)
+
+	macs = make([]uint8, t.params.MacLen)
+	out = t.operation(instance|0x80, sqn, amf)
+	pull(out[:], macs, 0)
+	return
+}
+
+// res and ak
+func (t *Tuak) F2F5() ([]uint8, []uint8) {
+	out := t.f2f5()
+	res := make([]uint8, t.params.ResLen)
+	ak := make([]uint8, 6)
+	pull(out[:], res, 0)
+	pull(out[:], ak, 96)
+	return res, ak
+}
+
+func (t *Tuak) F3() []uint8 {
+	out := t.f2f5()
+	ck := make([]uint8, t.params.CkLen)
+	pull(out[:], ck, 32)
+	return ck
+}
+
+func (t *Tuak) F4() []uint8 {
+	out := t.f2f5()
+	ik := make([]uint8, t.params.IkLen)
+	pull(out[:], ik, 64)
+	return ik
+}
+
+func (t *Tuak) F5star() []uint8 {
+	out := t.operation(t.keyFlag()|0xc0, nil, nil)
+	akstar := make([]uint8, 6)
+	pull(out[:], akstar, 96)
+	return akstar
+}
+
+func (t *Tuak) ValidateAuts(auts, randv []byte) (sqn [6]uint8, err error) {
+	if len(auts) != 6+t.params.MacLen || len(randv) != 16 {
+		err = fmt.Errorf("Wrong input size:auts[%d],rand[%d]", len(auts), len(randv))
+		return
+	}
+
+	t.SetRand(randv) //never fails
+
+	var amf [2]uint8 //resync: dummy amf='0000'
+
+	ak_r := t.F5star()
+	for i := 0; i < 6; i++ {
+		sqn[i] = ak_r[i] ^ auts[i]
+	}
+	_, macs, _ := t.F1(sqn[:], amf[:]) //never fails
+
+	if !bytes.Equal(macs, auts[6:]) {
+		err = fmt.Errorf("MAC failed: calculated MAC=%x, received MAC=%x", macs, auts[6:])
+	}
+	return
+}
+
+func (t *Tuak) f2f5() [200]uint8 {
+	instance := t.keyFlag() | 0x40 | resLenFlag(t.params.ResLen)
+	if t.params.CkLen == 32 {
+		instance |= 0x04
+	}
+	if t.params.IkLen == 32 {
+		instance |= 0x02
+	}
+	return t.operation(instance, nil, nil)
+}
+
+// run the Keccak permutation(s) over TOPc || INSTANCE || ALGONAME || RAND ||
+// AMF || SQN || KEY
+func (t *Tuak) operation(instance uint8, sqn, amf []uint8) (state [200]uint8) {
+	t.load(&state, t.topc[:], instance, func(s []uint8) {
+		push(s, t.rand[:], 40)
+		if amf != nil {
+			push(s, amf, 56)
+		}
+		if sqn != nil {
+			push(s, sqn, 58)
+		}
+	})
+	return
+}
+
+func (t *Tuak) load(state *[200]uint8, top []uint8, instance uint8, fill func([]uint8)) {
+	push(state[:], top, 0)
+	state[32] = instance
+	push(state[:], []uint8(tuakAlgoName), 33)
+	if fill != nil {
+		fill(state[:])
+	}
+	push(state[:], t.k, 64)
+	//padding
+	state[96] = 0x1f
+	state[135] = 0x80
+	for i := 0; i < t.params.Iterations; i++ {
+		keccakF1600(state)
+	}
+}
+
+func (t *Tuak) keyFlag() uint8 {
+	if len(t.k) == 32 {
+		return 0x01
+	}
+	return 0x00
+}
+
+func macLenFlag(l int) uint8 {
+	switch l {
+	case 16:
+		return 0x10
+	case 32:
+		return 0x20
+	}
+	return 0x08
+}
+
+func resLenFlag(l int) uint8 {
+	switch l {
+	case 8:
+		return 0x08
+	case 16:
+		return 0x10
+	case 32:
+		return 0x20
+	}
+	return 0x00
+}
+
+// write data into the state at offset in reversed byte order
+func push(state []uint8, data []uint8, offset int) {
+	n := len(data)
+	for i := 0; i < n; i++ {
+		state[offset+i] = data[n-1-i]
+	}
+}
+
+// read data out of the state at offset in reversed byte order
+func pull(state []uint8, data []uint8, offset int) {
+	n := len(data)
+	for i := 0; i < n; i++ {
+		data[i] = state[offset+n-1-i]
+	}
+}
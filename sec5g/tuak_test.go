@@ -0,0 +1,142 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+type TuakTestCase struct {
+	K       string
+	RAND    string
+	SQN     string
+	AMF     string
+	TOP     string
+	Params  TuakParams
+	eTOPC   string
+	f1      string
+	f1star  string
+	eRES    string
+	eCK     string
+	eIK     string
+	eAK     string
+	eAKstar string
+}
+
+func TestTuak(t *testing.T) {
+	table := []TuakTestCase{
+		{ // TS 35.232 test set 1
+			K:       "abababababababababababababababab",
+			RAND:    "42424242424242424242424242424242",
+			SQN:     "111111111111",
+			AMF:     "ffff",
+			TOP:     "5555555555555555555555555555555555555555555555555555555555555555",
+			Params:  TuakParams{ResLen: 4, MacLen: 8, CkLen: 16, IkLen: 16, Iterations: 1},
+			eTOPC:   "bd04d9530e87513c5d837ac2ad954623a8e2330c115305a73eb45d1f40cccbff",
+			f1:      "f9a54e6aeaa8618d",
+			f1star:  "e94b4dc6c7297df3",
+			eRES:    "657acd64",
+			eCK:     "d71a1e5c6caffe986a26f783e5c78be1",
+			eIK:     "be849fa2564f869aecee6f62d4337e72",
+			eAK:     "719f1e9b9054",
+			eAKstar: "e7af6b3d0e38",
+		},
+	}
+	for i, tc := range table {
+		K, _ := hex.DecodeString(tc.K)
+		RAND, _ := hex.DecodeString(tc.RAND)
+		SQN, _ := hex.DecodeString(tc.SQN)
+		AMF, _ := hex.DecodeString(tc.AMF)
+		TOP, _ := hex.DecodeString(tc.TOP)
+
+		tk, err := NewTuakEx(K, nil, TOP, false, &tc.Params)
+		if err != nil {
+			t.Fatalf("[%d] failed to create a Tuak object: %+v", i, err)
+		}
+		if err = tk.SetRand(RAND); err != nil {
+			t.Fatalf("[%d] err: %+v", i, err)
+		}
+		maca, macs, err := tk.F1(SQN, AMF)
+		if err != nil {
+			t.Fatalf("[%d] err: %+v", i, err)
+		}
+		res, ak := tk.F2F5()
+
+		check := func(name string, v []uint8, expected string) {
+			if hex.EncodeToString(v) != expected {
+				t.Errorf("[%d] test %s failed: %x != %s", i, name, v, expected)
+			}
+		}
+		check("TOPC", tk.topc[:], tc.eTOPC)
+		check("F1", maca, tc.f1)
+		check("F1Star", macs, tc.f1star)
+		check("RES", res, tc.eRES)
+		check("CK", tk.F3(), tc.eCK)
+		check("IK", tk.F4(), tc.eIK)
+		check("AK", ak, tc.eAK)
+		check("AKstar", tk.F5star(), tc.eAKstar)
+
+		//the same object must be usable with a precomputed TOPc
+		tk2, _ := NewTuakEx(K, nil, tk.topc[:], true, &tc.Params)
+		tk2.SetRand(RAND)
+		if maca2, _, _ := tk2.F1(SQN, AMF); !bytes.Equal(maca, maca2) {
+			t.Errorf("[%d] F1 mismatch with precomputed TOPC", i)
+		}
+	}
+}
+
+func TestTuakParams(t *testing.T) {
+	K, _ := hex.DecodeString("abababababababababababababababababababababababababababababababab")
+	TOP := bytes.Repeat([]uint8{0x55}, 32)
+	params := TuakParams{ResLen: 32, MacLen: 32, CkLen: 32, IkLen: 32, Iterations: 2}
+	tk, err := NewTuakEx(K, nil, TOP, false, &params)
+	if err != nil {
+		t.Fatalf("failed to create a Tuak object: %+v", err)
+	}
+	res, ak := tk.F2F5()
+	maca, macs, _ := tk.F1(make([]uint8, 6), make([]uint8, 2))
+	if len(res) != 32 || len(ak) != 6 || len(tk.F3()) != 32 || len(tk.F4()) != 32 || len(maca) != 32 || len(macs) != 32 {
+		t.Errorf("wrong output sizes")
+	}
+	if _, err = NewTuakEx(K, nil, TOP, false, &TuakParams{ResLen: 5, MacLen: 8, CkLen: 16, IkLen: 16, Iterations: 1}); err == nil {
+		t.Errorf("invalid RES length must be rejected")
+	}
+	if _, err = NewTuak(K[:20], TOP, false); err == nil {
+		t.Errorf("invalid key length must be rejected")
+	}
+
+	//the defaults are returned by value
+	defaults := DefaultTuakParams()
+	defaults.ResLen = 32
+	if DefaultTuakParams().ResLen != 8 {
+		t.Errorf("default TUAK parameters must not be modifiable")
+	}
+}
+
+func TestTuakAuts(t *testing.T) {
+	K, _ := hex.DecodeString("abababababababababababababababab")
+	TOP := bytes.Repeat([]uint8{0x55}, 32)
+	SQN, _ := hex.DecodeString("0000000000af")
+	tk, _ := NewTuak(K, TOP, false)
+	RAND := append([]uint8{}, tk.GetRand()...)
+
+	//build AUTS as an USIM would: SQN xor AK* || MAC-S
+	_, macs, _ := tk.F1(SQN, make([]uint8, 2))
+	auts := tk.F5star()
+	for i := 0; i < 6; i++ {
+		auts[i] ^= SQN[i]
+	}
+	auts = append(auts, macs...)
+
+	sqn, err := tk.ValidateAuts(auts, RAND)
+	if err != nil {
+		t.Fatalf("ValidateAuts failed: %+v", err)
+	}
+	if !bytes.Equal(sqn[:], SQN) {
+		t.Errorf("wrong recovered SQN %x", sqn)
+	}
+	auts[13] ^= 0xff
+	if _, err = tk.ValidateAuts(auts, RAND); err == nil {
+		t.Errorf("corrupted AUTS must be rejected")
+	}
+}
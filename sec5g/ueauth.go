@@ -17,28 +17,42 @@ const (
 	FC_FOR_KAMF_PRIME_DERIVATION         = "72"
 	FC_FOR_KGNB_KN3IWF_DERIVATION        = "6E"
 	FC_FOR_NH_DERIVATION                 = "6F"
+	FC_FOR_KGNB_STAR_DERIVATION          = "70"
+	FC_FOR_KSN_DERIVATION                = "79"
+	FC_FOR_S_KGNB_DERIVATION             = "1C"
+	FC_FOR_KASME_DERIVATION              = "10"
+	FC_FOR_KASME_PRIME_IDLE_DERIVATION   = "73"
+	FC_FOR_KASME_PRIME_HO_DERIVATION     = "74"
+	FC_FOR_KAMF_FROM_KASME_IDLE          = "75"
+	FC_FOR_KAMF_FROM_KASME_HO            = "76"
+	FC_FOR_KAKMA_DERIVATION              = "80"
+	FC_FOR_A_TID_DERIVATION              = "81"
+	FC_FOR_KAF_DERIVATION                = "82"
+	FC_FOR_SOR_MAC_IAUSF                 = "77"
+	FC_FOR_SOR_MAC_IUE                   = "78"
+	FC_FOR_UPU_MAC_IAUSF                 = "7B"
+	FC_FOR_UPU_MAC_IUE                   = "7C"
 )
 
-func kdfLen(input []byte) []byte {
-	r := make([]byte, 2)
-	binary.BigEndian.PutUint16(r, uint16(len(input)))
-	return r
-}
-
 // This function implements the KDF defined in TS.33220 cluase B.2.0.
 //
 // For P0-Pn, the ones that will be used directly as a string (e.g. "WLAN") should be type-casted by []byte(),
 // and the ones originally in hex (e.g. "bb52e91c747a") should be converted by using hex.DecodeString().
+// A single byte FC goes through the pooled KdfEngine, any other FC string is
+// decoded and used as the raw prefix of S.
 func KDF(key []byte, FC string, param ...[]byte) (sum []byte, err error) {
-	kdf := hmac.New(sha256.New, key)
-
 	var s []byte
 	if s, err = hex.DecodeString(FC); err != nil {
 		return
 	}
+	if len(s) == 1 {
+		sum = KDFWithFC(key, s[0], param...)
+		return
+	}
 
+	kdf := hmac.New(sha256.New, key)
 	for _, p := range param {
-		s = append(append(s, p...), kdfLen(p)...)
+		s = binary.BigEndian.AppendUint16(append(s, p...), uint16(len(p)))
 	}
 
 	if _, err = kdf.Write(s); err != nil {
@@ -48,54 +62,59 @@ func KDF(key []byte, FC string, param ...[]byte) (sum []byte, err error) {
 	return
 }
 
+// SeafKey derives KSEAF from KAUSF (FC 0x6C). The returned error is always nil.
 func SeafKey(key []byte, p ...[]byte) (sum []byte, err error) {
-	sum, err = KDF(key, FC_FOR_KSEAF_DERIVATION, p...)
+	sum = KDFWithFC(key, FC_KSEAF, p...)
 	return
 }
+
+// AlgKey derives a NAS or AS algorithm key (FC 0x69). The returned error is always nil.
 func AlgKey(key []byte, p ...[]byte) (sum []byte, err error) {
-	sum, err = KDF(key, FC_FOR_ALGORITHM_KEY_DERIVATION, p...)
+	sum = KDFWithFC(key, FC_ALGORITHM_KEY, p...)
 	return
 }
 
+// RanKey derives KgNB or KN3IWF from KAMF (FC 0x6E). The returned error is always nil.
 func RanKey(key []byte, p ...[]byte) (sum []byte, err error) {
-	sum, err = KDF(key, FC_FOR_KGNB_KN3IWF_DERIVATION, p...)
+	sum = KDFWithFC(key, FC_KGNB_KN3IWF, p...)
 	return
 }
+
+// NhKey derives NH from KAMF (FC 0x6F). The returned error is always nil.
 func NhKey(key []byte, p ...[]byte) (sum []byte, err error) {
-	sum, err = KDF(key, FC_FOR_NH_DERIVATION, p...)
+	sum = KDFWithFC(key, FC_NH, p...)
 	return
 }
 
+// KAMF derives KAMF from KSEAF (FC 0x6D). The returned error is always nil.
 func KAMF(kseaf, supi, abba []byte) (kamf []byte, err error) {
-	kamf, err = KDF(kseaf, FC_FOR_KAMF_DERIVATION, supi, abba)
+	kamf = KDFWithFC(kseaf, FC_KAMF, supi, abba)
 	return
 }
+
+// KamfPrime derives KAMF' on inter AMF mobility (FC 0x72). The returned error is always nil.
 func KamfPrime(kamf, direction, count []byte) (kamfprime []byte, err error) {
-	kamfprime, err = KDF(kamf, FC_FOR_KAMF_PRIME_DERIVATION, direction, count)
+	kamfprime = KDFWithFC(kamf, FC_KAMF_PRIME, direction, count)
 	return
 }
 
+// KAUSF derives KAUSF from CK||IK (FC 0x6A). The returned error is always nil.
 func KAUSF(ckik []byte, servingnet, sqnxorak []byte) (kausf []byte, err error) {
-	kausf, err = KDF(ckik, FC_FOR_KAUSF_DERIVATION, servingnet, sqnxorak)
+	kausf = KDFWithFC(ckik, FC_KAUSF, servingnet, sqnxorak)
 	return
 }
 
+// CkPrimeIkPrime derives CK' and IK' for EAP-AKA' (FC 0x20). The returned error is always nil.
 func CkPrimeIkPrime(key []byte, servingnet []byte, sqnxorak []byte) (ck []byte, ik []byte, err error) {
-	var buf []byte
-	if buf, err = KDF(key, FC_FOR_CK_PRIME_IK_PRIME_DERIVATION, servingnet, sqnxorak); err == nil {
-		l := len(buf) / 2
-		ck = buf[:l]
-		ik = buf[l:]
-	}
+	buf := KDFWithFC(key, FC_CK_PRIME_IK_PRIME, servingnet, sqnxorak)
+	ck, ik = buf[:16], buf[16:]
 	return
 }
 
+// ResstarXresstar splits the RES*/XRES* KDF output (FC 0x6B) into its two
+// 128 bit halves. The returned error is always nil.
 func ResstarXresstar(key, servingnet, rand, res []byte) (resstar []byte, xresstar []byte, err error) {
-	var buf []byte
-	if buf, err = KDF(key, FC_FOR_RES_STAR_XRES_STAR_DERIVATION, servingnet, rand, res); err == nil {
-		l := len(buf) / 2
-		resstar = buf[:l]
-		xresstar = buf[l:]
-	}
+	buf := KDFWithFC(key, FC_RES_STAR_XRES_STAR, servingnet, rand, res)
+	resstar, xresstar = buf[:16], buf[16:]
 	return
 }
@@ -0,0 +1,114 @@
+package sec5g
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SqnChecker decides whether a SQN received in an AUTN is acceptable
+// (TS 33.102 6.3.3)
+type SqnChecker func(sqn [6]uint8) bool
+
+// MacFailure is returned when the MAC-A of an AUTN does not verify
+type MacFailure struct {
+	Expected []uint8 //computed XMAC-A
+	Received []uint8 //MAC-A from AUTN
+}
+
+func (e *MacFailure) Error() string {
+	return fmt.Sprintf("MAC failed: calculated MAC=%x, received MAC=%x", e.Expected, e.Received)
+}
+
+// SyncFailure is returned when the SQN of an AUTN is not fresh; Auts is the
+// re-synchronisation token to send back to the network
+type SyncFailure struct {
+	Sqn  [6]uint8 //received SQN
+	Auts []uint8  //SQN_MS xor AK* || MAC-S
+}
+
+func (e *SyncFailure) Error() string {
+	return fmt.Sprintf("Synch failure: SQN=%x is out of range", e.Sqn)
+}
+
+// UE-side result of a successful AUTN verification
+type UsimResult struct {
+	Sqn [6]uint8
+	Res []uint8
+	Ck  []uint8
+	Ik  []uint8
+}
+
+// VerifyAutn runs the USIM side of the authentication (TS 33.102 6.3.3):
+// SQN is recovered with AK, MAC-A is checked then the freshness of SQN is
+// checked with the given checker (nil accepts any SQN). On a freshness
+// failure a *SyncFailure carrying AUTS built from sqnms is returned; on a
+// MAC failure a *MacFailure is returned.
+func VerifyAutn(f AuthFunctions, randv, autn []uint8, sqnms []uint8, check SqnChecker) (r *UsimResult, err error) {
+	if len(randv) != 16 || len(autn) < 16 || len(sqnms) != 6 {
+		err = fmt.Errorf("Wrong input size:rand[%d],autn[%d],sqn[%d]", len(randv), len(autn), len(sqnms))
+		return
+	}
+	if err = f.SetRand(randv); err != nil {
+		return
+	}
+	res, ak := f.F2F5()
+
+	var sqn [6]uint8
+	for i := 0; i < 6; i++ {
+		sqn[i] = autn[i] ^ ak[i]
+	}
+	var xmac []uint8
+	if xmac, _, err = f.F1(sqn[:], autn[6:8]); err != nil {
+		return
+	}
+	if !bytes.Equal(xmac, autn[8:]) {
+		err = &MacFailure{
+			Expected: xmac,
+			Received: append([]uint8{}, autn[8:]...),
+		}
+		return
+	}
+
+	if check != nil && !check(sqn) {
+		var auts []uint8
+		if auts, err = GenerateAuts(f, randv, sqnms); err != nil {
+			return
+		}
+		err = &SyncFailure{
+			Sqn:  sqn,
+			Auts: auts,
+		}
+		return
+	}
+
+	r = &UsimResult{
+		Sqn: sqn,
+		Res: res,
+		Ck:  f.F3(),
+		Ik:  f.F4(),
+	}
+	return
+}
+
+// GenerateAuts builds AUTS = SQN_MS xor AK* || MAC-S where MAC-S is computed
+// with f1* over SQN_MS and a dummy AMF of zeros (TS 33.102 6.3.3)
+func GenerateAuts(f AuthFunctions, randv []uint8, sqnms []uint8) (auts []uint8, err error) {
+	if len(sqnms) != 6 {
+		err = fmt.Errorf("Wrong SQN size")
+		return
+	}
+	if err = f.SetRand(randv); err != nil {
+		return
+	}
+	var amf [2]uint8 //resync: dummy amf='0000'
+	var macs []uint8
+	if _, macs, err = f.F1(sqnms, amf[:]); err != nil {
+		return
+	}
+	auts = f.F5star()
+	for i := 0; i < 6; i++ {
+		auts[i] ^= sqnms[i]
+	}
+	auts = append(auts, macs...)
+	return
+}
@@ -0,0 +1,55 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestVerifyAutn(t *testing.T) {
+	//TS 35.208 test set 1
+	K, _ := hex.DecodeString("465b5ce8b199b49faa5f0a2ee238a6bc")
+	OP, _ := hex.DecodeString("cdc202d5123e20f62b6d676ac72cb318")
+	RAND, _ := hex.DecodeString("23553cbe9637a89d218ae64dae47bf35")
+	AUTN, _ := hex.DecodeString("55f328b43577b9b94a9ffac354dfafb3")
+	eSQN, _ := hex.DecodeString("ff9bb4d0b607")
+	eRES, _ := hex.DecodeString("a54211d5e3ba50bf")
+	eCK, _ := hex.DecodeString("b40ba9a3c58b2a05bbf0d987b21bf8cb")
+	eIK, _ := hex.DecodeString("f769bcd751044604127672711c6d3441")
+	SQNMS, _ := hex.DecodeString("ffffffffff00")
+
+	usim, _ := NewMilenage(K, OP, false)
+	r, err := VerifyAutn(usim, RAND, AUTN, SQNMS, nil)
+	if err != nil {
+		t.Fatalf("VerifyAutn failed: %+v", err)
+	}
+	if !bytes.Equal(r.Sqn[:], eSQN) || !bytes.Equal(r.Res, eRES) || !bytes.Equal(r.Ck, eCK) || !bytes.Equal(r.Ik, eIK) {
+		t.Errorf("wrong USIM outputs: %+v", r)
+	}
+
+	//MAC failure
+	bad := append([]uint8{}, AUTN...)
+	bad[15] ^= 0x01
+	var macErr *MacFailure
+	if _, err = VerifyAutn(usim, RAND, bad, SQNMS, nil); !errors.As(err, &macErr) {
+		t.Errorf("expect a MAC failure, got %v", err)
+	}
+
+	//sync failure: the network must recover SQN_MS from AUTS
+	var syncErr *SyncFailure
+	_, err = VerifyAutn(usim, RAND, AUTN, SQNMS, func(sqn [6]uint8) bool {
+		return bytes.Compare(sqn[:], SQNMS) > 0
+	})
+	if !errors.As(err, &syncErr) {
+		t.Fatalf("expect a sync failure, got %v", err)
+	}
+	hn, _ := NewMilenage(K, OP, false)
+	sqn, err := hn.ValidateAuts(syncErr.Auts, RAND)
+	if err != nil {
+		t.Fatalf("ValidateAuts failed: %+v", err)
+	}
+	if !bytes.Equal(sqn[:], SQNMS) {
+		t.Errorf("wrong SQN_MS recovered from AUTS: %x", sqn)
+	}
+}
@@ -0,0 +1,104 @@
+package sec5g
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestZuc(t *testing.T) {
+	//ZUC specification test vectors 1 and 2
+	table := []struct {
+		Key, IV string
+		Z       []uint32
+	}{
+		{
+			Key: "00000000000000000000000000000000",
+			IV:  "00000000000000000000000000000000",
+			Z:   []uint32{0x27bede74, 0x018082da},
+		},
+		{
+			Key: "ffffffffffffffffffffffffffffffff",
+			IV:  "ffffffffffffffffffffffffffffffff",
+			Z:   []uint32{0x0657cfa0, 0x7096398b},
+		},
+	}
+	for i, tc := range table {
+		key, _ := hex.DecodeString(tc.Key)
+		iv, _ := hex.DecodeString(tc.IV)
+		z, err := ZucKeystream(key, iv, len(tc.Z))
+		if err != nil {
+			t.Fatalf("[%d] ZucKeystream failed: %+v", i, err)
+		}
+		for j := range z {
+			if z[j] != tc.Z[j] {
+				t.Errorf("[%d] wrong keystream word %d: %08x", i, j, z[j])
+			}
+		}
+	}
+}
+
+func TestNEA3(t *testing.T) {
+	//128-EEA3 test set 1
+	table := []NasAlgTestCase{
+		{
+			Key:       "173d14ba5003731d7a60049470f00a29",
+			Count:     0x66035492,
+			Bearer:    0x0f,
+			Direction: 0,
+			Length:    193,
+			Input:     "6cf65340735552ab0c9752fa6f9025fe0bd675d9005875b200000000",
+			Output:    "a6c85fc66afb8533aafc2518dfe784940ee1e4b030238cc800",
+		},
+	}
+	for i, tc := range table {
+		key, _ := hex.DecodeString(tc.Key)
+		in, _ := hex.DecodeString(tc.Input)
+		out, err := NEA3(key, tc.Count, tc.Bearer, tc.Direction, in, tc.Length)
+		if err != nil {
+			t.Fatalf("[%d] NEA3 failed: %+v", i, err)
+		}
+		if hex.EncodeToString(out) != tc.Output {
+			t.Errorf("[%d] wrong ciphertext %x", i, out)
+		}
+		plain, _ := NEA3(key, tc.Count, tc.Bearer, tc.Direction, out, tc.Length)
+		if !bytes.Equal(plain, in[:len(plain)]) {
+			t.Errorf("[%d] wrong deciphered text %x", i, plain)
+		}
+	}
+}
+
+func TestNIA3(t *testing.T) {
+	//128-EIA3 test sets 1 and 2
+	table := []NasAlgTestCase{
+		{
+			Key:       "00000000000000000000000000000000",
+			Count:     0,
+			Bearer:    0,
+			Direction: 0,
+			Length:    1,
+			Input:     "00000000",
+			Output:    "c8a9595e",
+		},
+		{
+			Key:       "47054125561eb2dda94059da05097850",
+			Count:     0x561eb2dd,
+			Bearer:    0x14,
+			Direction: 0,
+			Length:    90,
+			Input:     "000000000000000000000000",
+			Output:    "6719a088",
+		},
+	}
+	for i, tc := range table {
+		key, _ := hex.DecodeString(tc.Key)
+		in, _ := hex.DecodeString(tc.Input)
+		mac, err := NIA3(key, tc.Count, tc.Bearer, tc.Direction, in, tc.Length)
+		if err != nil {
+			t.Fatalf("[%d] NIA3 failed: %+v", i, err)
+		}
+		if hex.EncodeToString(mac) != tc.Output {
+			t.Errorf("[%d] wrong MAC %x", i, mac)
+		}
+	}
+}